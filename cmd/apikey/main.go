@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/jonmanahan/url-shortener/internal/auth"
+	"github.com/jonmanahan/url-shortener/internal/config"
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+	"github.com/jonmanahan/url-shortener/internal/repository"
+)
+
+// apikey issues a new API key for an owner. The plaintext key is printed
+// once; only its hash is stored.
+func main() {
+	owner := flag.String("owner", "", "owner (team) the key belongs to")
+	name := flag.String("name", "", "human-readable label for the key")
+	plan := flag.String("plan", models.DefaultPlan, "plan whose quotas apply to the key")
+	flag.Parse()
+
+	if *owner == "" {
+		fmt.Fprintln(os.Stderr, "usage: apikey -owner <owner> [-name <label>] [-plan <plan>]")
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+	cfg := config.Load()
+
+	var keys interfaces.APIKeyRepository
+	if path, ok := repository.BoltPath(cfg.DatabaseURL); ok {
+		// The server must be stopped: the embedded store is locked while open
+		db, err := repository.NewBoltDB(path)
+		if err != nil {
+			log.Fatalf("Failed to open embedded store: %v", err)
+		}
+		defer db.Close()
+		keys = repository.NewBoltAPIKeyRepository(db)
+	} else {
+		db, err := repository.NewPostgresDB(cfg.DatabaseURL, repository.Timeouts{
+			Read:  cfg.DBReadTimeout,
+			Write: cfg.DBWriteTimeout,
+			Batch: cfg.DBBatchTimeout,
+		})
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer db.Close()
+		keys = repository.NewAPIKeyRepository(db)
+	}
+
+	key, err := auth.GenerateAPIKey()
+	if err != nil {
+		log.Fatalf("Failed to generate API key: %v", err)
+	}
+
+	created, err := keys.CreateAPIKey(context.Background(), &models.APIKey{
+		OwnerID: *owner,
+		Name:    *name,
+		KeyHash: auth.HashAPIKey(key),
+		Plan:    *plan,
+	})
+	if err != nil {
+		log.Fatalf("Failed to store API key: %v", err)
+	}
+
+	fmt.Printf("Created API key %d for owner %q on plan %q\n", created.ID, created.OwnerID, created.Plan)
+	fmt.Printf("Key (shown once, store it securely): %s\n", key)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
@@ -9,12 +10,18 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/jonmanahan/url-shortener/internal/auth"
+	"github.com/jonmanahan/url-shortener/internal/cache"
 	"github.com/jonmanahan/url-shortener/internal/config"
 	"github.com/jonmanahan/url-shortener/internal/handlers"
+	"github.com/jonmanahan/url-shortener/internal/health"
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+	"github.com/jonmanahan/url-shortener/internal/ratelimit"
 	"github.com/jonmanahan/url-shortener/internal/repository"
 	"github.com/jonmanahan/url-shortener/internal/service"
+	"github.com/jonmanahan/url-shortener/internal/shortcode"
 )
 
 func main() {
@@ -26,60 +33,197 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
-	// Initialize database (with graceful fallback for development)
-	db, err := repository.NewPostgresDB(cfg.DatabaseURL)
-	if err != nil {
-		log.Printf("Warning: Failed to connect to database: %v", err)
-		log.Printf("Running in degraded mode - only health endpoint available")
-
-		// Setup basic router for health check only
-		r := gin.Default()
-		r.GET("/health", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{
-				"status": "degraded",
-				"service": "url-shortener",
-				"database": "disconnected",
-			})
-		})
-
-		srv := &http.Server{
-			Addr:         ":" + cfg.Port,
-			Handler:      r,
-			ReadTimeout:  15 * time.Second,
-			WriteTimeout: 15 * time.Second,
+	if cfg.Storage == config.StorageMemory {
+		// Everything in process: no database or Redis required
+		stores, err := newMemoryBackend(cfg)
+		if err != nil {
+			log.Fatalf("Failed to set up in-memory storage: %v", err)
 		}
+		log.Printf("Using in-memory storage; data is lost on restart")
+		runServer(cfg, stores)
+		return
+	}
 
-		log.Printf("Server starting on port %s (degraded mode)", cfg.Port)
-		log.Fatal(srv.ListenAndServe())
+	// A file:// DATABASE_URL selects the embedded single-file store
+	if path, ok := repository.BoltPath(cfg.DatabaseURL); ok {
+		db, err := repository.NewBoltDB(path)
+		if err != nil {
+			log.Fatalf("Failed to open embedded store: %v", err)
+		}
+		defer db.Close()
+		log.Printf("Using embedded storage at %s", path)
+		runServer(cfg, newBoltBackend(db))
 		return
 	}
+
+	// Initialize database. The server starts even if it is down and keeps
+	// retrying in the background, serving cached redirects meanwhile.
+	db, err := repository.OpenPostgresDB(cfg.DatabaseURL, repository.Timeouts{
+		Read:  cfg.DBReadTimeout,
+		Write: cfg.DBWriteTimeout,
+		Batch: cfg.DBBatchTimeout,
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure database: %v", err)
+	}
 	defer db.Close()
 
+	database := health.NewMonitor("database", true, db.Ping, cfg.DependencyCheckInterval)
+	defer database.Close()
+
+	stores := backend{
+		urls:         repository.NewURLRepository(db),
+		clicks:       repository.NewClickRepository(db),
+		apiKeys:      repository.NewAPIKeyRepository(db),
+		usage:        repository.NewUsageRepository(db),
+		keyPool:      repository.NewKeyPoolRepository(db),
+		counter:      repository.NewSequenceCounter(db),
+		dependencies: []*health.Monitor{database},
+	}
+
 	// Initialize Redis (optional - service should work without it)
-	var redisClient *repository.RedisClient
 	if cfg.RedisURL != "" {
-		redisClient = repository.NewRedisClient(cfg.RedisURL)
+		redisClient := repository.NewRedisClient(cfg.RedisURL)
 		defer redisClient.Close()
+		stores.cache = redisClient
+
+		// Rate limits are shared by all instances
+		limiter, err := repository.NewRedisRateLimiter(redisClient, cfg.RateLimitAlgorithm)
+		if err != nil {
+			log.Fatalf("Failed to configure rate limiting: %v", err)
+		}
+		stores.limiter = limiter
+
+		redis := health.NewMonitor("redis", false, redisClient.Ping, cfg.DependencyCheckInterval)
+		defer redis.Close()
+		stores.dependencies = append(stores.dependencies, redis)
+
+		// Hot links are also kept in process, invalidated over pub/sub
+		if cfg.LocalCacheSize > 0 {
+			tiered := cache.NewTiered(cache.NewLRU(cfg.LocalCacheSize), redisClient, cfg.LocalCacheTTL, redisClient)
+			defer tiered.Close()
+			expvar.Publish("cache", expvar.Func(func() any { return tiered.Stats() }))
+			stores.cache = tiered
+		}
+	}
+
+	runServer(cfg, stores)
+}
+
+// backend is the storage the server runs on.
+type backend struct {
+	urls    interfaces.URLRepository
+	clicks  interfaces.ClickRepository
+	apiKeys interfaces.APIKeyRepository
+	usage   interfaces.UsageRepository
+	keyPool interfaces.KeyPoolRepository
+	counter shortcode.Counter
+	// cache is nil when no cache is configured.
+	cache interfaces.Cache
+	// limiter is nil to count requests in process.
+	limiter interfaces.RateLimiter
+	// dependencies are the external services being monitored, if any.
+	dependencies []*health.Monitor
+}
+
+// newMemoryBackend keeps all data in process and registers cfg.DevAPIKey,
+// or a freshly generated key, so the API can be used straight away.
+func newMemoryBackend(cfg *config.Config) (backend, error) {
+	store := repository.NewMemoryStore()
+	stores := backend{
+		urls:    repository.NewMemoryURLRepository(store),
+		clicks:  repository.NewMemoryClickRepository(store),
+		apiKeys: repository.NewMemoryAPIKeyRepository(store),
+		usage:   repository.NewMemoryUsageRepository(store),
+		keyPool: repository.NewMemoryKeyPoolRepository(store),
+		counter: repository.NewMemorySequenceCounter(store),
+		cache:   repository.NewMemoryCache(),
 	}
 
-	// Initialize repository
-	urlRepo := repository.NewURLRepository(db)
+	key := cfg.DevAPIKey
+	if key == "" {
+		generated, err := auth.GenerateAPIKey()
+		if err != nil {
+			return backend{}, err
+		}
+		key = generated
+		log.Printf("Generated development API key: %s", key)
+	}
+	_, err := stores.apiKeys.CreateAPIKey(context.Background(), &models.APIKey{
+		OwnerID: "dev",
+		Name:    "development",
+		KeyHash: auth.HashAPIKey(key),
+		Plan:    "unlimited",
+	})
+	if err != nil {
+		return backend{}, err
+	}
+
+	return stores, nil
+}
+
+// newBoltBackend stores everything in the embedded file. The cache lives in
+// process, since the file can only be served by one instance anyway.
+func newBoltBackend(db *repository.BoltDB) backend {
+	return backend{
+		urls:    repository.NewBoltURLRepository(db),
+		clicks:  repository.NewBoltClickRepository(db),
+		apiKeys: repository.NewBoltAPIKeyRepository(db),
+		usage:   repository.NewBoltUsageRepository(db),
+		keyPool: repository.NewBoltKeyPoolRepository(db),
+		counter: repository.NewBoltSequenceCounter(db),
+		cache:   repository.NewMemoryCache(),
+	}
+}
+
+// runServer serves the full API on stores until SIGINT or SIGTERM.
+func runServer(cfg *config.Config, stores backend) {
+	// Optional destination blocklist, re-read on SIGHUP
+	var policies []service.URLPolicy
+	if cfg.BlocklistFile != "" {
+		blocklist, err := service.NewBlocklist(cfg.BlocklistFile)
+		if err != nil {
+			log.Fatalf("Failed to load blocklist: %v", err)
+		}
+		log.Printf("Loaded %d blocklisted domains", blocklist.Len())
+		policies = append(policies, blocklist)
+		go reloadOnHangup(blocklist)
+	}
+
+	// Short code generator selected by CODE_GENERATOR
+	codes, err := shortcode.New(cfg.CodeGenerator, cfg.CodeLength, cfg.CodeSecret, stores.counter)
+	if err != nil {
+		log.Fatalf("Failed to configure short codes: %v", err)
+	}
+
+	// Optionally serve codes from the pre-generated key pool
+	if cfg.KeyPoolEnabled {
+		keyPool := service.NewKeyPool(stores.keyPool, codes, cfg.KeyPoolBlockSize, cfg.KeyPoolTarget)
+		defer keyPool.Close()
+		codes = keyPool
+	}
 
 	// Initialize services
-	urlService := service.NewURLService(urlRepo, redisClient)
+	urlService := service.NewURLService(stores.urls, stores.cache, codes, cfg, policies...)
+	analyticsService := service.NewAnalyticsService(stores.clicks, stores.urls, cfg)
+	defer analyticsService.Close()
+	quotaService := service.NewQuotaService(stores.usage)
+
+	// Without Redis, requests are counted by this instance alone
+	limiter := stores.limiter
+	if limiter == nil {
+		memoryLimiter, err := ratelimit.NewMemory(cfg.RateLimitAlgorithm)
+		if err != nil {
+			log.Fatalf("Failed to configure rate limiting: %v", err)
+		}
+		limiter = memoryLimiter
+	}
 
 	// Initialize handlers
-	h := handlers.New(urlService)
+	h := handlers.New(urlService, analyticsService, quotaService, stores.dependencies...)
 
 	// Setup router
-	r := gin.Default()
-
-	// Health check
-	r.GET("/health", h.Health)
-
-	// URL shortener endpoints
-	r.POST("/shorten", h.Shorten)
-	r.GET("/:shortCode", h.Resolve)
+	r := handlers.NewRouter(h, stores.apiKeys, limiter, cfg.RateLimits)
 
 	// Setup server
 	srv := &http.Server{
@@ -97,12 +241,40 @@ func main() {
 		}
 	}()
 
+	// Runtime counters are kept off the public listener
+	if cfg.AdminAddr != "" {
+		admin := http.NewServeMux()
+		admin.Handle("/debug/vars", expvar.Handler())
+		adminSrv := &http.Server{
+			Addr:         cfg.AdminAddr,
+			Handler:      admin,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+		}
+		defer adminSrv.Close()
+
+		go func() {
+			log.Printf("Admin server starting on %s", cfg.AdminAddr)
+			if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Admin server failed to start: %v", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Server shutting down...")
 
+	// Fail readiness first so load balancers stop sending traffic, unless
+	// a second signal asks to stop right away
+	h.Drain()
+	select {
+	case <-time.After(cfg.ShutdownDrainDelay):
+	case <-quit:
+	}
+
 	// Graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -112,3 +284,16 @@ func main() {
 
 	log.Println("Server exited")
 }
+
+// reloadOnHangup re-reads the blocklist each time the process gets SIGHUP.
+func reloadOnHangup(blocklist *service.Blocklist) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := blocklist.Reload(); err != nil {
+			log.Printf("Failed to reload blocklist: %v", err)
+			continue
+		}
+		log.Printf("Reloaded blocklist with %d domains", blocklist.Len())
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+const (
+	// APIKeyHeader is an alternative to "Authorization: Bearer <key>".
+	APIKeyHeader = "X-API-Key"
+
+	apiKeyPrefix  = "us_"
+	apiKeyBytes   = 32
+	contextKeyKey = "auth.api_key"
+)
+
+// GenerateAPIKey returns a new random plaintext API key. Only its hash
+// (see HashAPIKey) should ever be persisted.
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashAPIKey returns the hex-encoded SHA-256 digest stored for a key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Middleware authenticates requests by API key and stores the key on the gin
+// context. Requests without a valid key are rejected with 401.
+func Middleware(keys interfaces.APIKeyRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := extractAPIKey(c.Request)
+		if raw == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "API key required",
+			})
+			return
+		}
+
+		key, err := keys.GetAPIKeyByHash(c.Request.Context(), HashAPIKey(raw))
+		if err != nil {
+			if errors.Is(err, interfaces.ErrInvalidAPIKey) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": "Invalid API key",
+				})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "Internal server error",
+			})
+			return
+		}
+
+		c.Set(contextKeyKey, key)
+		c.Next()
+	}
+}
+
+// APIKey returns the authenticated key for the request, or nil when the
+// route is not behind Middleware.
+func APIKey(c *gin.Context) *models.APIKey {
+	if v, ok := c.Get(contextKeyKey); ok {
+		if key, ok := v.(*models.APIKey); ok {
+			return key
+		}
+	}
+	return nil
+}
+
+// OwnerID returns the owner of the authenticated key, or "" when the request
+// is anonymous.
+func OwnerID(c *gin.Context) string {
+	if key := APIKey(c); key != nil {
+		return key.OwnerID
+	}
+	return ""
+}
+
+func extractAPIKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	const bearer = "Bearer "
+	if h := r.Header.Get("Authorization"); len(h) > len(bearer) && strings.EqualFold(h[:len(bearer)], bearer) {
+		return strings.TrimSpace(h[len(bearer):])
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// Mock API key repository for testing
+type mockAPIKeyRepository struct {
+	keys       map[string]*models.APIKey
+	shouldFail bool
+}
+
+func (m *mockAPIKeyRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error) {
+	m.keys[key.KeyHash] = key
+	return key, nil
+}
+
+func (m *mockAPIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	if m.shouldFail {
+		return nil, errors.New("mock error")
+	}
+	if key, ok := m.keys[keyHash]; ok {
+		return key, nil
+	}
+	return nil, interfaces.ErrInvalidAPIKey
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	rawKey, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey failed: %v", err)
+	}
+	repo := &mockAPIKeyRepository{keys: map[string]*models.APIKey{}}
+	_, _ = repo.CreateAPIKey(context.Background(), &models.APIKey{OwnerID: "team-a", KeyHash: HashAPIKey(rawKey)})
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		shouldFail bool
+		wantStatus int
+	}{
+		{"bearer token", "Authorization", "Bearer " + rawKey, false, http.StatusOK},
+		{"api key header", APIKeyHeader, rawKey, false, http.StatusOK},
+		{"missing key", "", "", false, http.StatusUnauthorized},
+		{"unknown key", APIKeyHeader, "us_unknown", false, http.StatusUnauthorized},
+		{"repository failure", APIKeyHeader, rawKey, true, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo.shouldFail = tt.shouldFail
+
+			var owner string
+			r := gin.New()
+			r.GET("/protected", Middleware(repo), func(c *gin.Context) {
+				owner = OwnerID(c)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/protected", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus == http.StatusOK && owner != "team-a" {
+				t.Errorf("Expected owner team-a, got %q", owner)
+			}
+		})
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	if HashAPIKey("abc") != HashAPIKey("abc") {
+		t.Error("Expected hashing to be deterministic")
+	}
+	if len(HashAPIKey("abc")) != 64 {
+		t.Errorf("Expected 64 hex characters, got %d", len(HashAPIKey("abc")))
+	}
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU(2)
+	c.Set("a", "1", time.Minute)
+	c.Set("b", "2", time.Minute)
+
+	// Reading "a" makes "b" the eviction candidate
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("Expected a to be cached")
+	}
+	c.Set("c", "3", time.Minute)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("Expected %s to be cached", key)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", c.Len())
+	}
+}
+
+func TestLRU_ExpiresEntries(t *testing.T) {
+	c := NewLRU(10)
+	c.Set("short", "1", 10*time.Millisecond)
+	c.Set("long", "2", time.Minute)
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := c.Get("short"); ok {
+		t.Error("Expected expired entry to be a miss")
+	}
+	if v, ok := c.Get("long"); !ok || v != "2" {
+		t.Errorf("Expected long-lived entry, got %q, %v", v, ok)
+	}
+}
+
+func TestLRU_SetReplacesAndDelRemoves(t *testing.T) {
+	c := NewLRU(10)
+	c.Set("a", "1", time.Minute)
+	c.Set("a", "2", time.Minute)
+
+	if v, _ := c.Get("a"); v != "2" {
+		t.Errorf("Expected replaced value 2, got %q", v)
+	}
+
+	c.Del("a", "missing")
+	if _, ok := c.Get("a"); ok {
+		t.Error("Expected deleted entry to be a miss")
+	}
+}
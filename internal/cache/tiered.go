@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+)
+
+// InvalidationChannel is the pub/sub channel on which instances announce
+// deleted cache keys.
+const InvalidationChannel = "cache:invalidate"
+
+// Broadcaster carries invalidations between instances, e.g. Redis pub/sub.
+type Broadcaster interface {
+	Publish(ctx context.Context, channel, message string) error
+	// Subscribe delivers messages published on channel until ctx is done,
+	// reconnecting as needed.
+	Subscribe(ctx context.Context, channel string) <-chan string
+}
+
+// Stats counts lookups per tier. Remote lookups only happen on local misses.
+type Stats struct {
+	LocalHits    int64 `json:"local_hits"`
+	LocalMisses  int64 `json:"local_misses"`
+	RemoteHits   int64 `json:"remote_hits"`
+	RemoteMisses int64 `json:"remote_misses"`
+}
+
+// Tiered is an interfaces.Cache that keeps hot keys in an in-process LRU
+// for a short TTL in front of a shared remote cache. Deletes are broadcast
+// so other instances drop their local copy; if a broadcast is missed, the
+// local TTL bounds how long an instance serves a stale value.
+type Tiered struct {
+	local  *LRU
+	remote interfaces.Cache
+	ttl    time.Duration
+	bus    Broadcaster
+
+	localHits, localMisses   atomic.Int64
+	remoteHits, remoteMisses atomic.Int64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewTiered layers local over remote, keeping entries locally for at most
+// ttl. bus may be nil for a single instance.
+func NewTiered(local *LRU, remote interfaces.Cache, ttl time.Duration, bus Broadcaster) *Tiered {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &Tiered{
+		local:  local,
+		remote: remote,
+		ttl:    ttl,
+		bus:    bus,
+		cancel: cancel,
+	}
+
+	if bus != nil {
+		t.wg.Add(1)
+		go t.listen(ctx)
+	}
+
+	return t
+}
+
+// Close stops listening for invalidations.
+func (t *Tiered) Close() {
+	t.cancel()
+	t.wg.Wait()
+}
+
+func (t *Tiered) listen(ctx context.Context) {
+	defer t.wg.Done()
+	for message := range t.bus.Subscribe(ctx, InvalidationChannel) {
+		t.local.Del(strings.Split(message, "\n")...)
+	}
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) (string, error) {
+	if value, ok := t.local.Get(key); ok {
+		t.localHits.Add(1)
+		return value, nil
+	}
+	t.localMisses.Add(1)
+
+	value, err := t.remote.Get(ctx, key)
+	if err != nil {
+		t.remoteMisses.Add(1)
+		return "", err
+	}
+	t.remoteHits.Add(1)
+	t.local.Set(key, value, t.ttl)
+
+	return value, nil
+}
+
+func (t *Tiered) Set(ctx context.Context, key, value string, expiration time.Duration) error {
+	if err := t.remote.Set(ctx, key, value, expiration); err != nil {
+		return err
+	}
+	t.local.Set(key, value, t.localTTL(expiration))
+	return nil
+}
+
+func (t *Tiered) SetMany(ctx context.Context, entries []interfaces.CacheEntry) error {
+	if err := t.remote.SetMany(ctx, entries); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		t.local.Set(e.Key, e.Value, t.localTTL(e.Expiration))
+	}
+	return nil
+}
+
+// Del removes keys from both tiers and tells other instances to drop them.
+// The remote delete happens first so no instance refills its local tier
+// with the old value.
+func (t *Tiered) Del(ctx context.Context, keys ...string) error {
+	if err := t.remote.Del(ctx, keys...); err != nil {
+		return err
+	}
+	t.local.Del(keys...)
+	if t.bus != nil {
+		if err := t.bus.Publish(ctx, InvalidationChannel, strings.Join(keys, "\n")); err != nil {
+			log.Printf("Warning: failed to broadcast cache invalidation: %v", err)
+		}
+	}
+	return nil
+}
+
+// Stats returns the lookup counters since the cache was created.
+func (t *Tiered) Stats() Stats {
+	return Stats{
+		LocalHits:    t.localHits.Load(),
+		LocalMisses:  t.localMisses.Load(),
+		RemoteHits:   t.remoteHits.Load(),
+		RemoteMisses: t.remoteMisses.Load(),
+	}
+}
+
+// localTTL caps the local lifetime of an entry at its remote expiration.
+func (t *Tiered) localTTL(expiration time.Duration) time.Duration {
+	if expiration > 0 && expiration < t.ttl {
+		return expiration
+	}
+	return t.ttl
+}
@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/repository"
+)
+
+// localBus is an in-process Broadcaster delivering to every subscriber.
+type localBus struct {
+	mu   sync.Mutex
+	subs []chan string
+}
+
+func (b *localBus) Publish(ctx context.Context, channel, message string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, sub := range b.subs {
+		sub <- message
+	}
+	return nil
+}
+
+func (b *localBus) Subscribe(ctx context.Context, channel string) <-chan string {
+	sub := make(chan string, 16)
+	b.mu.Lock()
+	b.subs = append(b.subs, sub)
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, s := range b.subs {
+			if s == sub {
+				b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			}
+		}
+		close(sub)
+	}()
+	return sub
+}
+
+// blockingDelCache holds each Del until release is closed, signalling
+// entered once it is waiting.
+type blockingDelCache struct {
+	*repository.MemoryCache
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingDelCache) Del(ctx context.Context, keys ...string) error {
+	close(c.entered)
+	<-c.release
+	return c.MemoryCache.Del(ctx, keys...)
+}
+
+func TestTiered_CountsHitsPerTier(t *testing.T) {
+	ctx := context.Background()
+	remote := repository.NewMemoryCache()
+	_ = remote.Set(ctx, "url:abc", "value", time.Minute)
+
+	c := NewTiered(NewLRU(10), remote, time.Minute, nil)
+	defer c.Close()
+
+	if _, err := c.Get(ctx, "url:missing"); err == nil {
+		t.Error("Expected a miss for an unknown key")
+	}
+	for i := 0; i < 3; i++ {
+		if v, err := c.Get(ctx, "url:abc"); err != nil || v != "value" {
+			t.Fatalf("Get = %q, %v", v, err)
+		}
+	}
+
+	want := Stats{LocalHits: 2, LocalMisses: 2, RemoteHits: 1, RemoteMisses: 1}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestTiered_LocalTTLCappedByExpiration(t *testing.T) {
+	ctx := context.Background()
+	local := NewLRU(10)
+	c := NewTiered(local, repository.NewMemoryCache(), time.Minute, nil)
+	defer c.Close()
+
+	if err := c.Set(ctx, "url:abc", "value", 10*time.Millisecond); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := local.Get("url:abc"); ok {
+		t.Error("Expected local entry to expire with the remote one")
+	}
+}
+
+func TestTiered_GetDuringDelDoesNotRefillLocal(t *testing.T) {
+	ctx := context.Background()
+	remote := &blockingDelCache{
+		MemoryCache: repository.NewMemoryCache(),
+		entered:     make(chan struct{}),
+		release:     make(chan struct{}),
+	}
+	local := NewLRU(10)
+	c := NewTiered(local, remote, time.Minute, nil)
+	defer c.Close()
+
+	if err := c.Set(ctx, "url:abc", "old", time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.Del(ctx, "url:abc") }()
+	<-remote.entered
+	_, _ = c.Get(ctx, "url:abc")
+	close(remote.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+
+	if v, ok := local.Get("url:abc"); ok {
+		t.Errorf("Expected no local entry after Del, got %q", v)
+	}
+}
+
+func TestTiered_DelInvalidatesOtherInstances(t *testing.T) {
+	ctx := context.Background()
+	remote := repository.NewMemoryCache()
+	bus := &localBus{}
+
+	localA, localB := NewLRU(10), NewLRU(10)
+	a := NewTiered(localA, remote, time.Minute, bus)
+	defer a.Close()
+	b := NewTiered(localB, remote, time.Minute, bus)
+	defer b.Close()
+
+	// Wait until both instances are subscribed
+	deadline := time.Now().Add(time.Second)
+	for {
+		bus.mu.Lock()
+		n := len(bus.subs)
+		bus.mu.Unlock()
+		if n == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := a.Set(ctx, "url:abc", "old", time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if v, _ := b.Get(ctx, "url:abc"); v != "old" {
+		t.Fatalf("Expected b to read the value, got %q", v)
+	}
+
+	if err := a.Del(ctx, "url:abc"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+
+	deadline = time.Now().Add(time.Second)
+	for {
+		if _, ok := localB.Get("url:abc"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected b's local entry to be invalidated")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := b.Get(ctx, "url:abc"); err == nil {
+		t.Error("Expected b to miss after invalidation")
+	}
+}
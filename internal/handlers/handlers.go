@@ -1,30 +1,56 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jonmanahan/url-shortener/internal/auth"
+	"github.com/jonmanahan/url-shortener/internal/health"
 	"github.com/jonmanahan/url-shortener/internal/interfaces"
 	"github.com/jonmanahan/url-shortener/internal/models"
+	"github.com/jonmanahan/url-shortener/internal/qrcode"
+)
+
+const (
+	// permanentRedirectMaxAge bounds how long clients may cache a 301/308.
+	permanentRedirectMaxAge = 24 * time.Hour
+
+	// qrCacheSize is how many rendered QR images are kept in memory.
+	qrCacheSize = 1024
+	// qrMaxAge is how long clients may cache a QR image.
+	qrMaxAge = 24 * time.Hour
 )
 
 type Handlers struct {
-	urlService interfaces.URLService
+	urlService       interfaces.URLService
+	analyticsService interfaces.AnalyticsService
+	// quotas counts links created with API keys against their plans; nil
+	// disables link quotas.
+	quotas      interfaces.QuotaService
+	qrGenerator *qrcode.Generator
+	// dependencies are reported by /health and /readyz; required ones gate
+	// the routes that need the database.
+	dependencies []*health.Monitor
+	// draining is set on shutdown so /readyz fails before the server stops.
+	draining atomic.Bool
 }
 
-func New(urlService interfaces.URLService) *Handlers {
+func New(urlService interfaces.URLService, analyticsService interfaces.AnalyticsService, quotas interfaces.QuotaService, dependencies ...*health.Monitor) *Handlers {
 	return &Handlers{
-		urlService: urlService,
+		urlService:       urlService,
+		analyticsService: analyticsService,
+		quotas:           quotas,
+		qrGenerator:      qrcode.NewGenerator(qrCacheSize),
+		dependencies:     dependencies,
 	}
 }
 
-func (h *Handlers) Health(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "healthy",
-		"service": "url-shortener",
-	})
-}
-
 func (h *Handlers) Shorten(c *gin.Context) {
 	var req models.ShortenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -34,32 +60,169 @@ func (h *Handlers) Shorten(c *gin.Context) {
 		return
 	}
 
-	// Check rate limit
-	clientIP := c.ClientIP()
-	allowed, err := h.urlService.CheckRateLimit(c.Request.Context(), clientIP)
+	release, ok := h.reserveLinks(c, 1)
+	if !ok {
+		return
+	}
+
+	// Shorten the URL on behalf of the authenticated key's owner
+	req.OwnerID = auth.OwnerID(c)
+	response, err := h.urlService.ShortenURL(c.Request.Context(), &req)
+	if err != nil {
+		release(0)
+		status, message := shortenError(err)
+		body := gin.H{
+			"error": message,
+		}
+		if rule := policyRule(err); rule != "" {
+			body["rule"] = rule
+		}
+		c.JSON(status, body)
+		return
+	}
+
+	// An existing link returned by dedupe was not created by this request
+	if response.Deduplicated {
+		release(0)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	release(1)
+	c.JSON(http.StatusCreated, response)
+}
+
+func (h *Handlers) ShortenBatch(c *gin.Context) {
+	var req models.BatchShortenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	// The whole batch must fit the quota; links that are not created are
+	// given back afterwards
+	release, ok := h.reserveLinks(c, len(req.Items))
+	if !ok {
+		return
+	}
+
+	req.OwnerID = auth.OwnerID(c)
+	results, err := h.urlService.ShortenURLs(c.Request.Context(), &req)
 	if err != nil {
+		release(0)
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Internal server error",
+			"error": "Failed to shorten URLs",
 		})
 		return
 	}
-	if !allowed {
-		c.JSON(http.StatusTooManyRequests, gin.H{
-			"error": "Rate limit exceeded",
+
+	response := models.BatchShortenResponse{Results: results}
+	created := 0
+	for i := range response.Results {
+		result := &response.Results[i]
+		if result.Err != nil {
+			result.Status, result.Error = shortenError(result.Err)
+			result.Rule = policyRule(result.Err)
+			response.Failed++
+			continue
+		}
+		result.Status = http.StatusCreated
+		if result.Deduplicated {
+			result.Status = http.StatusOK
+		} else {
+			created++
+		}
+		response.Succeeded++
+	}
+	release(created)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// reserveLinks reserves n links against the quota of the request's API key.
+// If they do not fit, it responds with 429 and a Retry-After header until the
+// quota resets, and returns false. The returned function must be called with
+// how many links were created.
+func (h *Handlers) reserveLinks(c *gin.Context, n int) (func(created int), bool) {
+	if h.quotas == nil {
+		return func(int) {}, true
+	}
+
+	release, err := h.quotas.ReserveLinks(c.Request.Context(), auth.APIKey(c), n)
+	if err != nil {
+		var quotaErr *interfaces.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			c.Header("Retry-After", strconv.Itoa(max(ceilSeconds(time.Until(quotaErr.ResetsAt)), 1)))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":     "Link quota exceeded",
+				"period":    quotaErr.Period,
+				"limit":     quotaErr.Limit,
+				"used":      quotaErr.Used,
+				"resets_at": quotaErr.ResetsAt,
+			})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to check link quota",
+		})
+		return nil, false
+	}
+
+	return release, true
+}
+
+// Usage reports the authenticated API key's plan and the links it created
+// today and this month.
+func (h *Handlers) Usage(c *gin.Context) {
+	key := auth.APIKey(c)
+	if h.quotas == nil || key == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Usage is not tracked",
 		})
 		return
 	}
 
-	// Shorten the URL
-	response, err := h.urlService.ShortenURL(c.Request.Context(), req.URL)
+	usage, err := h.quotas.Usage(c.Request.Context(), key)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to shorten URL",
+			"error": "Failed to get usage",
 		})
 		return
 	}
 
-	c.JSON(http.StatusCreated, response)
+	c.JSON(http.StatusOK, usage)
+}
+
+// shortenError maps an error from creating a link to a status code and a
+// client-facing message.
+func shortenError(err error) (int, string) {
+	switch {
+	case errors.Is(err, interfaces.ErrInvalidURL),
+		errors.Is(err, interfaces.ErrInvalidDomain),
+		errors.Is(err, interfaces.ErrInvalidAlias),
+		errors.Is(err, interfaces.ErrInvalidExpiry),
+		errors.Is(err, interfaces.ErrInvalidRedirectType):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, interfaces.ErrURLRejected):
+		return http.StatusUnprocessableEntity, err.Error()
+	case errors.Is(err, interfaces.ErrAliasTaken):
+		return http.StatusConflict, "Alias already in use"
+	case errors.Is(err, interfaces.ErrKeyspaceExhausted):
+		return http.StatusServiceUnavailable, "No short code available, try again later"
+	default:
+		return http.StatusInternalServerError, "Failed to shorten URL"
+	}
+}
+
+// policyRule returns the URL policy rule that rejected a destination, or ""
+// if err is not a policy rejection.
+func policyRule(err error) string {
+	var policyErr *interfaces.PolicyError
+	if errors.As(err, &policyErr) {
+		return policyErr.Rule
+	}
+	return ""
 }
 
 func (h *Handlers) Resolve(c *gin.Context) {
@@ -72,14 +235,241 @@ func (h *Handlers) Resolve(c *gin.Context) {
 	}
 
 	// Resolve the URL
-	originalURL, err := h.urlService.ResolveURL(c.Request.Context(), shortCode)
+	url, err := h.urlService.ResolveURL(c.Request.Context(), c.Request.Host, shortCode)
+	if err != nil {
+		if errors.Is(err, interfaces.ErrLinkExpired) {
+			c.JSON(http.StatusGone, gin.H{
+				"error": "Short link has expired",
+			})
+			return
+		}
+		// Links missing from the cache cannot be resolved while the
+		// database is down
+		if !errors.Is(err, interfaces.ErrLinkNotFound) {
+			if retryAfter, down := h.unavailable(); down {
+				respondUnavailable(c, retryAfter)
+				return
+			}
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Short code not found",
+		})
+		return
+	}
+
+	// Record the click asynchronously; this never blocks the redirect
+	if h.analyticsService != nil {
+		h.analyticsService.RecordClick(models.ClickEvent{
+			ShortCode: shortCode,
+			Host:      c.Request.Host,
+			Referrer:  c.Request.Referer(),
+			UserAgent: c.Request.UserAgent(),
+			IPAddress: c.ClientIP(),
+		})
+	}
+
+	// Redirect to original URL with the link's redirect type
+	c.Header("Cache-Control", redirectCacheControl(url, time.Now()))
+	c.Redirect(url.RedirectStatus(), url.OriginalURL)
+}
+
+// redirectCacheControl lets browsers and CDNs cache permanent redirects for a
+// bounded time (never past the link's expiry) and forbids caching temporary
+// ones so every visit reaches the service.
+func redirectCacheControl(url *models.URL, now time.Time) string {
+	if !url.IsPermanentRedirect() {
+		return "no-store"
+	}
+
+	maxAge := permanentRedirectMaxAge
+	if url.ExpiresAt != nil {
+		if remaining := url.ExpiresAt.Sub(now); remaining < maxAge {
+			maxAge = remaining
+		}
+	}
+	if maxAge <= 0 {
+		return "no-store"
+	}
+	return fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+}
+
+// QRCode renders a QR code for the link's short URL. Query parameters:
+// format (png|svg), size (pixels), margin (modules) and level (L|M|Q|H).
+func (h *Handlers) QRCode(c *gin.Context) {
+	opts, err := qrOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	shortURL, err := h.urlService.ShortURL(c.Request.Context(), c.Request.Host, c.Param("shortCode"))
 	if err != nil {
+		if errors.Is(err, interfaces.ErrLinkExpired) {
+			c.JSON(http.StatusGone, gin.H{
+				"error": "Short link has expired",
+			})
+			return
+		}
+		// Links missing from the cache cannot be resolved while the
+		// database is down
+		if !errors.Is(err, interfaces.ErrLinkNotFound) {
+			if retryAfter, down := h.unavailable(); down {
+				respondUnavailable(c, retryAfter)
+				return
+			}
+		}
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "Short code not found",
 		})
 		return
 	}
 
-	// Redirect to original URL
-	c.Redirect(http.StatusMovedPermanently, originalURL)
+	// The image only depends on the short URL and options, so it can be
+	// revalidated cheaply by ETag
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(fmt.Sprintf("%s|%+v", shortURL, opts))))
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(qrMaxAge.Seconds())))
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	image, err := h.qrGenerator.Generate(shortURL, opts)
+	if err != nil {
+		if errors.Is(err, qrcode.ErrInvalidOptions) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate QR code",
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, opts.ContentType(), image)
+}
+
+// qrOptions reads QR rendering options from the query string, falling back
+// to the defaults for anything not given.
+func qrOptions(c *gin.Context) (qrcode.Options, error) {
+	opts := qrcode.DefaultOptions()
+	if format := c.Query("format"); format != "" {
+		opts.Format = format
+	}
+	if level := c.Query("level"); level != "" {
+		opts.Level = level
+	}
+	if size := c.Query("size"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return opts, fmt.Errorf("%w: size must be an integer", qrcode.ErrInvalidOptions)
+		}
+		opts.Size = n
+	}
+	if margin := c.Query("margin"); margin != "" {
+		n, err := strconv.Atoi(margin)
+		if err != nil {
+			return opts, fmt.Errorf("%w: margin must be an integer", qrcode.ErrInvalidOptions)
+		}
+		opts.Margin = n
+	}
+	return opts, opts.Validate()
+}
+
+func (h *Handlers) Stats(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+
+	stats, err := h.analyticsService.GetLinkStats(c.Request.Context(), auth.OwnerID(c), c.Query("domain"), shortCode)
+	if err != nil {
+		respondLinkError(c, err, "Failed to get link stats")
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *Handlers) ListLinks(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+
+	list, err := h.urlService.ListURLs(c.Request.Context(), auth.OwnerID(c), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to list links",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handlers) GetLink(c *gin.Context) {
+	url, err := h.urlService.GetURL(c.Request.Context(), auth.OwnerID(c), c.Query("domain"), c.Param("shortCode"))
+	if err != nil {
+		respondLinkError(c, err, "Failed to get link")
+		return
+	}
+
+	c.JSON(http.StatusOK, url)
+}
+
+func (h *Handlers) UpdateLink(c *gin.Context) {
+	var req models.UpdateURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	url, err := h.urlService.UpdateURL(c.Request.Context(), auth.OwnerID(c), c.Query("domain"), c.Param("shortCode"), &req)
+	if err != nil {
+		respondLinkError(c, err, "Failed to update link")
+		return
+	}
+
+	c.JSON(http.StatusOK, url)
+}
+
+func (h *Handlers) DeleteLink(c *gin.Context) {
+	err := h.urlService.DeleteURL(c.Request.Context(), auth.OwnerID(c), c.Query("domain"), c.Param("shortCode"))
+	if err != nil {
+		respondLinkError(c, err, "Failed to delete link")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// respondLinkError writes 404 for unknown (or foreign) links, 400 for an
+// unknown domain or malformed destination, 422 for a destination refused by
+// the URL policy and a 500 with the given message for anything else.
+func respondLinkError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, interfaces.ErrLinkNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Short code not found",
+		})
+		return
+	case errors.Is(err, interfaces.ErrInvalidDomain),
+		errors.Is(err, interfaces.ErrInvalidURL),
+		errors.Is(err, interfaces.ErrInvalidRedirectType):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	case errors.Is(err, interfaces.ErrURLRejected):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+			"rule":  policyRule(err),
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": message,
+	})
 }
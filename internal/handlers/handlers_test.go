@@ -4,58 +4,150 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
 	"github.com/jonmanahan/url-shortener/internal/models"
+	"github.com/jonmanahan/url-shortener/internal/ratelimit"
 )
 
 // Mock URL service for testing
 type mockURLService struct {
-	shouldFailShorten   bool
-	shouldFailResolve   bool
-	shouldFailRateLimit bool
-	rateLimitExceeded   bool
+	shouldFailShorten bool
+	shouldFailResolve bool
 }
 
-func (m *mockURLService) ShortenURL(ctx context.Context, originalURL string) (*models.ShortenResponse, error) {
+func (m *mockURLService) ShortenURL(ctx context.Context, req *models.ShortenRequest) (*models.ShortenResponse, error) {
 	if m.shouldFailShorten {
 		return nil, context.DeadlineExceeded
 	}
 
+	if req.URL == "javascript:alert(1)" {
+		return nil, &interfaces.PolicyError{Rule: "scheme", Reason: `scheme "javascript" is not allowed`}
+	}
+
+	shortCode := "test123"
+	switch req.Alias {
+	case "":
+	case "taken":
+		return nil, interfaces.ErrAliasTaken
+	case "exhausted":
+		return nil, &interfaces.KeyspaceExhaustedError{Attempts: 5}
+	case "health":
+		return nil, fmt.Errorf("%w: %q is reserved", interfaces.ErrInvalidAlias, req.Alias)
+	default:
+		shortCode = req.Alias
+	}
+
 	return &models.ShortenResponse{
-		ShortCode:   "test123",
-		OriginalURL: originalURL,
-		ShortURL:    "http://localhost:8080/test123",
+		ShortCode:    shortCode,
+		OriginalURL:  req.URL,
+		ShortURL:     "http://localhost:8080/" + shortCode,
+		Deduplicated: req.Dedupe,
 	}, nil
 }
 
-func (m *mockURLService) ResolveURL(ctx context.Context, shortCode string) (string, error) {
+func (m *mockURLService) ShortenURLs(ctx context.Context, req *models.BatchShortenRequest) ([]models.BatchShortenResult, error) {
+	if m.shouldFailShorten {
+		return nil, context.DeadlineExceeded
+	}
+
+	results := make([]models.BatchShortenResult, len(req.Items))
+	for i := range req.Items {
+		results[i].Index = i
+		results[i].ShortenResponse, results[i].Err = m.ShortenURL(ctx, &req.Items[i])
+	}
+	return results, nil
+}
+
+func (m *mockURLService) ResolveURL(ctx context.Context, host, shortCode string) (*models.URL, error) {
 	if m.shouldFailResolve {
-		return "", context.DeadlineExceeded
+		return nil, context.DeadlineExceeded
+	}
+
+	switch shortCode {
+	case "test123":
+		return &models.URL{ShortCode: shortCode, OriginalURL: "https://example.com", RedirectType: http.StatusMovedPermanently}, nil
+	case "temp":
+		return &models.URL{ShortCode: shortCode, OriginalURL: "https://example.com", RedirectType: http.StatusFound}, nil
+	case "bad-type":
+		return &models.URL{ShortCode: shortCode, OriginalURL: "https://example.com", RedirectType: 999}, nil
+	case "expired":
+		return nil, interfaces.ErrLinkExpired
+	}
+
+	return nil, context.DeadlineExceeded
+}
+
+func (m *mockURLService) ShortURL(ctx context.Context, host, shortCode string) (string, error) {
+	url, err := m.ResolveURL(ctx, host, shortCode)
+	if err != nil {
+		return "", err
+	}
+	return "http://localhost:8080/" + url.ShortCode, nil
+}
+
+func (m *mockURLService) ListURLs(ctx context.Context, ownerID string, page, pageSize int) (*models.URLList, error) {
+	return &models.URLList{
+		URLs:     []*models.URL{{ShortCode: "test123", OriginalURL: "https://example.com"}},
+		Page:     page,
+		PageSize: pageSize,
+		Total:    1,
+	}, nil
+}
+
+func (m *mockURLService) GetURL(ctx context.Context, ownerID, domain, shortCode string) (*models.URL, error) {
+	if shortCode != "test123" {
+		return nil, interfaces.ErrLinkNotFound
 	}
+	return &models.URL{ShortCode: shortCode, OriginalURL: "https://example.com"}, nil
+}
+
+func (m *mockURLService) UpdateURL(ctx context.Context, ownerID, domain, shortCode string, req *models.UpdateURLRequest) (*models.URL, error) {
+	if shortCode != "test123" {
+		return nil, interfaces.ErrLinkNotFound
+	}
+	return &models.URL{ShortCode: shortCode, OriginalURL: req.URL}, nil
+}
 
-	if shortCode == "test123" {
-		return "https://example.com", nil
+func (m *mockURLService) DeleteURL(ctx context.Context, ownerID, domain, shortCode string) error {
+	if shortCode != "test123" {
+		return interfaces.ErrLinkNotFound
 	}
+	return nil
+}
+
+// Mock analytics service for testing
+type mockAnalyticsService struct {
+	events []models.ClickEvent
+}
 
-	return "", context.DeadlineExceeded
+func (m *mockAnalyticsService) RecordClick(event models.ClickEvent) {
+	m.events = append(m.events, event)
 }
 
-func (m *mockURLService) CheckRateLimit(ctx context.Context, clientIP string) (bool, error) {
-	if m.shouldFailRateLimit {
-		return false, context.DeadlineExceeded
+func (m *mockAnalyticsService) GetLinkStats(ctx context.Context, ownerID, domain, shortCode string) (*models.LinkStats, error) {
+	if shortCode != "test123" {
+		return nil, interfaces.ErrLinkNotFound
 	}
 
-	return !m.rateLimitExceeded, nil
+	return &models.LinkStats{
+		ShortCode:    shortCode,
+		TotalClicks:  int64(len(m.events)),
+		ClicksPerDay: []models.DailyClicks{},
+		TopReferrers: []models.ReferrerCount{},
+	}, nil
 }
 
 func TestHandlers_Health(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	h := New(nil)
+	h := New(nil, nil, nil)
 	r := gin.New()
 	r.GET("/health", h.Health)
 
@@ -83,7 +175,7 @@ func TestHandlers_Shorten_Success(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	mockService := &mockURLService{}
-	h := New(mockService)
+	h := New(mockService, nil, nil)
 	r := gin.New()
 	r.POST("/shorten", h.Shorten)
 
@@ -117,7 +209,7 @@ func TestHandlers_Shorten_InvalidRequest(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	mockService := &mockURLService{}
-	h := New(mockService)
+	h := New(mockService, nil, nil)
 	r := gin.New()
 	r.POST("/shorten", h.Shorten)
 
@@ -135,24 +227,114 @@ func TestHandlers_Shorten_InvalidRequest(t *testing.T) {
 func TestHandlers_Shorten_RateLimitExceeded(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	mockService := &mockURLService{rateLimitExceeded: true}
-	h := New(mockService)
+	limiter, err := ratelimit.NewMemory(ratelimit.AlgorithmSlidingWindow)
+	if err != nil {
+		t.Fatalf("NewMemory failed: %v", err)
+	}
+	mockService := &mockURLService{}
+	h := New(mockService, nil, nil)
 	r := gin.New()
-	r.POST("/shorten", h.Shorten)
+	r.POST("/shorten", RateLimit(limiter, RouteShorten, interfaces.RateLimit{Requests: 1, Period: time.Minute}), h.Shorten)
 
 	reqBody := models.ShortenRequest{
 		URL: "https://example.com",
 	}
 	jsonBody, _ := json.Marshal(reqBody)
 
-	req := httptest.NewRequest("POST", "/shorten", bytes.NewBuffer(jsonBody))
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/shorten", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+	}
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+}
+
+func TestHandlers_Shorten_Alias(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		alias      string
+		wantStatus int
+	}{
+		{"available alias", "q4-launch", http.StatusCreated},
+		{"taken alias", "taken", http.StatusConflict},
+		{"reserved alias", "health", http.StatusBadRequest},
+		{"keyspace exhausted", "exhausted", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockURLService{}, nil, nil)
+			r := gin.New()
+			r.POST("/shorten", h.Shorten)
+
+			reqBody := models.ShortenRequest{
+				URL:   "https://example.com",
+				Alias: tt.alias,
+			}
+			jsonBody, _ := json.Marshal(reqBody)
+
+			req := httptest.NewRequest("POST", "/shorten", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandlers_Shorten_PolicyRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(&mockURLService{}, nil, nil)
+	r := gin.New()
+	r.POST("/shorten", h.Shorten)
+
+	req := httptest.NewRequest("POST", "/shorten", bytes.NewBufferString(`{"url":"javascript:alert(1)"}`))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
 	r.ServeHTTP(w, req)
 
-	if w.Code != http.StatusTooManyRequests {
-		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+
+	var response map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response["rule"] != "scheme" || response["error"] == "" {
+		t.Errorf("Expected scheme rule with an explanation, got %v", response)
+	}
+}
+
+func TestHandlers_Shorten_Deduplicated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(&mockURLService{}, nil, nil)
+	r := gin.New()
+	r.POST("/shorten", h.Shorten)
+
+	req := httptest.NewRequest("POST", "/shorten", bytes.NewBufferString(`{"url":"https://example.com","dedupe":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d for an existing link, got %d", http.StatusOK, w.Code)
 	}
 }
 
@@ -160,7 +342,7 @@ func TestHandlers_Resolve_Success(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	mockService := &mockURLService{}
-	h := New(mockService)
+	h := New(mockService, nil, nil)
 	r := gin.New()
 	r.GET("/:shortCode", h.Resolve)
 
@@ -179,11 +361,55 @@ func TestHandlers_Resolve_Success(t *testing.T) {
 	}
 }
 
+func TestHandlers_Resolve_RedirectType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		path             string
+		wantStatus       int
+		wantCacheControl string
+	}{
+		{"/test123", http.StatusMovedPermanently, "public, max-age=86400"},
+		{"/temp", http.StatusFound, "no-store"},
+		{"/bad-type", http.StatusFound, "no-store"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			h := New(&mockURLService{}, nil, nil)
+			r := gin.New()
+			r.GET("/:shortCode", h.Resolve)
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.wantCacheControl {
+				t.Errorf("Expected Cache-Control %q, got %q", tt.wantCacheControl, got)
+			}
+		})
+	}
+}
+
+func TestRedirectCacheControl_CappedByExpiry(t *testing.T) {
+	now := time.Now()
+	expiresAt := now.Add(90 * time.Second)
+	url := &models.URL{RedirectType: http.StatusPermanentRedirect, ExpiresAt: &expiresAt}
+
+	if got := redirectCacheControl(url, now); got != "public, max-age=90" {
+		t.Errorf("Expected max-age capped at expiry, got %q", got)
+	}
+}
+
 func TestHandlers_Resolve_NotFound(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	mockService := &mockURLService{shouldFailResolve: true}
-	h := New(mockService)
+	h := New(mockService, nil, nil)
 	r := gin.New()
 	r.GET("/:shortCode", h.Resolve)
 
@@ -196,3 +422,209 @@ func TestHandlers_Resolve_NotFound(t *testing.T) {
 		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
 	}
 }
+
+func TestHandlers_Resolve_Expired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := &mockURLService{}
+	h := New(mockService, nil, nil)
+	r := gin.New()
+	r.GET("/:shortCode", h.Resolve)
+
+	req := httptest.NewRequest("GET", "/expired", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusGone {
+		t.Errorf("Expected status %d, got %d", http.StatusGone, w.Code)
+	}
+}
+
+func TestHandlers_Resolve_RecordsClick(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	analytics := &mockAnalyticsService{}
+	h := New(&mockURLService{}, analytics, nil)
+	r := gin.New()
+	r.GET("/:shortCode", h.Resolve)
+
+	req := httptest.NewRequest("GET", "/test123", nil)
+	req.Header.Set("Referer", "https://news.example.com")
+	req.Header.Set("User-Agent", "test-agent")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if len(analytics.events) != 1 {
+		t.Fatalf("Expected 1 click event, got %d", len(analytics.events))
+	}
+
+	event := analytics.events[0]
+	if event.ShortCode != "test123" || event.Referrer != "https://news.example.com" || event.UserAgent != "test-agent" {
+		t.Errorf("Unexpected click event: %+v", event)
+	}
+}
+
+func TestHandlers_Stats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(&mockURLService{}, &mockAnalyticsService{}, nil)
+	r := gin.New()
+	r.GET("/api/links/:shortCode/stats", h.Stats)
+
+	req := httptest.NewRequest("GET", "/api/links/test123/stats", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/links/nonexistent/stats", nil)
+	w = httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandlers_ManageLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(&mockURLService{}, nil, nil)
+	r := gin.New()
+	r.GET("/api/links", h.ListLinks)
+	r.GET("/api/links/:shortCode", h.GetLink)
+	r.PATCH("/api/links/:shortCode", h.UpdateLink)
+	r.DELETE("/api/links/:shortCode", h.DeleteLink)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"list", "GET", "/api/links?page=2&page_size=10", "", http.StatusOK},
+		{"get", "GET", "/api/links/test123", "", http.StatusOK},
+		{"get missing", "GET", "/api/links/nonexistent", "", http.StatusNotFound},
+		{"update", "PATCH", "/api/links/test123", `{"url":"https://example.org"}`, http.StatusOK},
+		{"update invalid url", "PATCH", "/api/links/test123", `{"url":"not a url"}`, http.StatusBadRequest},
+		{"update missing", "PATCH", "/api/links/nonexistent", `{"url":"https://example.org"}`, http.StatusNotFound},
+		{"delete", "DELETE", "/api/links/test123", "", http.StatusNoContent},
+		{"delete missing", "DELETE", "/api/links/nonexistent", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandlers_ShortenBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(&mockURLService{}, nil, nil)
+	r := gin.New()
+	r.POST("/api/shorten/batch", h.ShortenBatch)
+
+	body := `{"items":[{"url":"https://example.com"},{"url":"https://example.com","alias":"taken"}]}`
+	req := httptest.NewRequest("POST", "/api/shorten/batch", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response models.BatchShortenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Succeeded != 1 || response.Failed != 1 {
+		t.Errorf("Expected 1 success and 1 failure, got %+v", response)
+	}
+	if response.Results[0].Status != http.StatusCreated || response.Results[0].ShortenResponse == nil {
+		t.Errorf("Unexpected first result: %+v", response.Results[0])
+	}
+	if response.Results[1].Status != http.StatusConflict || response.Results[1].Error == "" {
+		t.Errorf("Unexpected second result: %+v", response.Results[1])
+	}
+
+	req = httptest.NewRequest("POST", "/api/shorten/batch", bytes.NewBufferString(`{"items":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for empty batch, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandlers_QRCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(&mockURLService{}, nil, nil)
+	r := gin.New()
+	r.GET("/:shortCode/qr", h.QRCode)
+
+	tests := []struct {
+		name            string
+		path            string
+		wantStatus      int
+		wantContentType string
+	}{
+		{"png default", "/test123/qr", http.StatusOK, "image/png"},
+		{"svg", "/test123/qr?format=svg&size=512&margin=2&level=H", http.StatusOK, "image/svg+xml"},
+		{"invalid size", "/test123/qr?size=abc", http.StatusBadRequest, ""},
+		{"invalid format", "/test123/qr?format=gif", http.StatusBadRequest, ""},
+		{"unknown code", "/nonexistent/qr", http.StatusNotFound, ""},
+		{"expired", "/expired/qr", http.StatusGone, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantContentType != "" && w.Header().Get("Content-Type") != tt.wantContentType {
+				t.Errorf("Expected content type %s, got %s", tt.wantContentType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	// A matching ETag is answered without re-sending the image
+	req := httptest.NewRequest("GET", "/test123/qr", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	req = httptest.NewRequest("GET", "/test123/qr", nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d, got %d", http.StatusNotModified, w.Code)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonmanahan/url-shortener/internal/health"
+)
+
+// Health reports the service as healthy when every monitored dependency is
+// up and as degraded otherwise, along with the state of each dependency.
+func (h *Handlers) Health(c *gin.Context) {
+	status := "healthy"
+	body := gin.H{
+		"service": "url-shortener",
+	}
+	if len(h.dependencies) > 0 {
+		states := make(map[string]health.State, len(h.dependencies))
+		for _, dep := range h.dependencies {
+			state := dep.State()
+			if state.Status != health.StatusUp {
+				status = "degraded"
+			}
+			states[dep.Name()] = state
+		}
+		body["dependencies"] = states
+	}
+	body["status"] = status
+	c.JSON(http.StatusOK, body)
+}
+
+// Livez reports that the process is up and serving requests. It checks no
+// dependencies, so an orchestrator only restarts instances that are stuck.
+func (h *Handlers) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "alive",
+	})
+}
+
+// Readyz pings every dependency and reports the instance ready while all
+// required ones respond. Optional dependencies, such as Redis, are reported
+// but do not affect readiness. Once Drain has been called it answers 503
+// without pinging anything, so load balancers stop routing to the instance.
+func (h *Handlers) Readyz(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "shutting_down",
+		})
+		return
+	}
+
+	states := make([]health.State, len(h.dependencies))
+	var wg sync.WaitGroup
+	for i, dep := range h.dependencies {
+		wg.Add(1)
+		go func(i int, dep *health.Monitor) {
+			defer wg.Done()
+			states[i] = dep.Check(c.Request.Context())
+		}(i, dep)
+	}
+	wg.Wait()
+
+	status, code := "ready", http.StatusOK
+	byName := make(map[string]health.State, len(states))
+	for i, state := range states {
+		if state.Required && state.Status != health.StatusUp {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+		byName[h.dependencies[i].Name()] = state
+	}
+	c.JSON(code, gin.H{
+		"status":       status,
+		"dependencies": byName,
+	})
+}
+
+// Drain marks the instance as shutting down: /readyz fails from now on while
+// requests keep being served.
+func (h *Handlers) Drain() {
+	h.draining.Store(true)
+}
+
+// RequireDependencies rejects requests with 503 while a required dependency
+// is down, telling clients when to retry.
+func (h *Handlers) RequireDependencies(c *gin.Context) {
+	if retryAfter, down := h.unavailable(); down {
+		respondUnavailable(c, retryAfter)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// unavailable reports whether a required dependency is down and the longest
+// wait until one is checked again.
+func (h *Handlers) unavailable() (time.Duration, bool) {
+	var retryAfter time.Duration
+	down := false
+	for _, dep := range h.dependencies {
+		if dep.Required() && !dep.Available() {
+			down = true
+			if wait := dep.RetryAfter(); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	return retryAfter, down
+}
+
+func respondUnavailable(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": "Service temporarily unavailable",
+	})
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonmanahan/url-shortener/internal/health"
+)
+
+func newTestMonitor(t *testing.T, name string, required, up bool) *health.Monitor {
+	t.Helper()
+	ping := func(ctx context.Context) error {
+		if !up {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	m := health.NewMonitor(name, required, ping, time.Minute)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestHandlers_Health_Dependencies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(&mockURLService{}, nil, nil,
+		newTestMonitor(t, "database", true, false),
+		newTestMonitor(t, "redis", false, true),
+	)
+	r := gin.New()
+	r.GET("/health", h.Health)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response struct {
+		Status       string                  `json:"status"`
+		Dependencies map[string]health.State `json:"dependencies"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Status != "degraded" {
+		t.Errorf("Expected status 'degraded', got %q", response.Status)
+	}
+	if db := response.Dependencies["database"]; db.Status != health.StatusDown || db.Error == "" {
+		t.Errorf("Expected database down with an error, got %+v", db)
+	}
+	if redis := response.Dependencies["redis"]; redis.Status != health.StatusUp {
+		t.Errorf("Expected redis up, got %+v", redis)
+	}
+}
+
+func TestHandlers_DatabaseDown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(&mockURLService{}, nil, nil, newTestMonitor(t, "database", true, false))
+	r := gin.New()
+	r.POST("/shorten", h.RequireDependencies, h.Shorten)
+	r.GET("/:shortCode", h.Resolve)
+
+	// Writes are refused with a hint when to retry
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/shorten", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After for writes, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Cached links still redirect
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/test123", nil))
+	if w.Code != http.StatusMovedPermanently {
+		t.Errorf("Expected cached link to redirect, got %d", w.Code)
+	}
+
+	// Others cannot be looked up until the database is back
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/uncached", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After for uncached link, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestHandlers_OptionalDependencyDown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(&mockURLService{}, nil, nil, newTestMonitor(t, "redis", false, false))
+	r := gin.New()
+	r.POST("/shorten", h.RequireDependencies, h.Shorten)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/shorten", nil))
+	if w.Code == http.StatusServiceUnavailable {
+		t.Errorf("Expected writes to be served without an optional dependency")
+	}
+}
+
+func TestHandlers_Readyz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		databaseUp bool
+		redisUp    bool
+		expected   int
+	}{
+		{"all up", true, true, http.StatusOK},
+		{"optional down", true, false, http.StatusOK},
+		{"required down", false, true, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockURLService{}, nil, nil,
+				newTestMonitor(t, "database", true, tt.databaseUp),
+				newTestMonitor(t, "redis", false, tt.redisUp),
+			)
+			r := gin.New()
+			r.GET("/readyz", h.Readyz)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+
+			var response struct {
+				Dependencies map[string]health.State `json:"dependencies"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			redis, ok := response.Dependencies["redis"]
+			if !ok || redis.Required || redis.LastCheck.IsZero() {
+				t.Errorf("Expected optional redis to be checked, got %+v", redis)
+			}
+		})
+	}
+}
+
+func TestHandlers_Readyz_Draining(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(&mockURLService{}, nil, nil)
+	r := gin.New()
+	r.GET("/livez", h.Livez)
+	r.GET("/readyz", h.Readyz)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected ready without dependencies, got %d", w.Code)
+	}
+
+	// Draining fails readiness but not liveness
+	h.Drain()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d while draining, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/livez", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d for /livez, got %d", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonmanahan/url-shortener/internal/auth"
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/ratelimit"
+)
+
+// Routes with their own rate limit, as named in RATE_LIMITS.
+const (
+	// RouteShorten is POST /shorten.
+	RouteShorten = "shorten"
+	// RouteBatch is POST /api/shorten/batch; a batch counts as one request.
+	RouteBatch = "batch"
+	// RouteAPI is the link management endpoints under /api/links and
+	// /api/usage.
+	RouteAPI = "api"
+	// RouteResolve is redirects and QR codes.
+	RouteResolve = "resolve"
+	// RouteAuth is every request needing an API key, counted per IP before
+	// the key is looked up so invalid keys cannot be tried without limit.
+	RouteAuth = "auth"
+)
+
+// DefaultRateLimits apply to routes without a configured limit. Redirects
+// are not limited by default. The auth limit is shared by everyone behind an
+// IP, so it is set well above what the per-key limits allow.
+var DefaultRateLimits = map[string]interfaces.RateLimit{
+	RouteAuth:    {Requests: 1000, Period: time.Minute},
+	RouteShorten: {Requests: 10, Period: time.Minute},
+	RouteBatch:   {Requests: 10, Period: time.Minute},
+	RouteAPI:     {Requests: 120, Period: time.Minute},
+}
+
+// RateLimit limits each client to limit requests to route. Clients are
+// identified by their API key when the route is behind auth.Middleware, so
+// clients sharing an IP do not share a limit, and by IP otherwise. Keys whose
+// plan sets requests per minute are also limited to that many across all
+// routes.
+//
+// Responses carry RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// headers for the limit closest to running out, and rejected ones a
+// Retry-After header, with times in seconds. A nil limiter disables
+// limiting and a zero limit leaves only the plan's; if the limiter fails,
+// requests are let through.
+func RateLimit(limiter interfaces.RateLimiter, route string, limit interfaces.RateLimit) gin.HandlerFunc {
+	if limiter == nil {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	return func(c *gin.Context) {
+		// Once a limit rejects the request the rest are not checked, but the
+		// ones checked before it have already counted it
+		var result *interfaces.RateLimitResult
+		for _, check := range rateLimitChecks(c, route, limit) {
+			r, err := limiter.Allow(c.Request.Context(), check.key, check.limit)
+			if err != nil {
+				continue
+			}
+			if result == nil || !r.Allowed || r.Remaining < result.Remaining {
+				result = &r
+			}
+			if !r.Allowed {
+				break
+			}
+		}
+		if result == nil {
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(max(ceilSeconds(result.RetryAfter), 1)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": "Rate limit exceeded",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitCheck is a limit and the key a client's requests are counted
+// under.
+type rateLimitCheck struct {
+	key   string
+	limit interfaces.RateLimit
+}
+
+// rateLimitChecks returns the route's limit and, for keys whose plan sets
+// one, the plan's requests per minute.
+func rateLimitChecks(c *gin.Context, route string, limit interfaces.RateLimit) []rateLimitCheck {
+	identity := "ip:" + c.ClientIP()
+	apiKey := auth.APIKey(c)
+	if apiKey != nil {
+		identity = "key:" + strconv.Itoa(apiKey.ID)
+	}
+
+	var checks []rateLimitCheck
+	if !ratelimit.Disabled(limit) {
+		checks = append(checks, rateLimitCheck{key: "ratelimit:" + route + ":" + identity, limit: limit})
+	}
+	if apiKey != nil && apiKey.Quota.RequestsPerMinute > 0 {
+		checks = append(checks, rateLimitCheck{
+			key:   "ratelimit:plan:" + identity,
+			limit: interfaces.RateLimit{Requests: apiKey.Quota.RequestsPerMinute, Period: time.Minute},
+		})
+	}
+	return checks
+}
+
+// routeLimit returns the configured limit for route, or its default.
+func routeLimit(limits map[string]interfaces.RateLimit, route string) interfaces.RateLimit {
+	if limit, ok := limits[route]; ok {
+		return limit
+	}
+	return DefaultRateLimits[route]
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
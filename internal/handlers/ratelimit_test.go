@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonmanahan/url-shortener/internal/auth"
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+	"github.com/jonmanahan/url-shortener/internal/ratelimit"
+	"github.com/jonmanahan/url-shortener/internal/repository"
+)
+
+// failingLimiter stands in for an unreachable Redis.
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, limit interfaces.RateLimit) (interfaces.RateLimitResult, error) {
+	return interfaces.RateLimitResult{}, errors.New("connection refused")
+}
+
+func newRateLimitedRouter(limiter interfaces.RateLimiter, limit interfaces.RateLimit) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/limited", RateLimit(limiter, "test", limit), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func TestRateLimit_Headers(t *testing.T) {
+	limiter, err := ratelimit.NewMemory(ratelimit.AlgorithmTokenBucket)
+	if err != nil {
+		t.Fatalf("NewMemory failed: %v", err)
+	}
+	r := newRateLimitedRouter(limiter, interfaces.RateLimit{Requests: 2, Period: time.Minute})
+
+	tests := []struct {
+		status     int
+		remaining  string
+		retryAfter string
+	}{
+		{http.StatusOK, "1", ""},
+		{http.StatusOK, "0", ""},
+		{http.StatusTooManyRequests, "0", "30"},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/limited", nil))
+
+		if w.Code != tt.status {
+			t.Errorf("Request %d: expected status %d, got %d", i+1, tt.status, w.Code)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("Request %d: expected RateLimit-Limit 2, got %q", i+1, got)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != tt.remaining {
+			t.Errorf("Request %d: expected RateLimit-Remaining %s, got %q", i+1, tt.remaining, got)
+		}
+		if got := w.Header().Get("RateLimit-Reset"); got == "" || got == "0" {
+			t.Errorf("Request %d: expected a RateLimit-Reset, got %q", i+1, got)
+		}
+		if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+			t.Errorf("Request %d: expected Retry-After %q, got %q", i+1, tt.retryAfter, got)
+		}
+	}
+}
+
+func TestRateLimit_ClientsAreIndependent(t *testing.T) {
+	limiter, err := ratelimit.NewMemory(ratelimit.AlgorithmSlidingLog)
+	if err != nil {
+		t.Fatalf("NewMemory failed: %v", err)
+	}
+	r := newRateLimitedRouter(limiter, interfaces.RateLimit{Requests: 1, Period: time.Minute})
+
+	for _, addr := range []string{"192.0.2.1:1234", "192.0.2.2:1234"} {
+		req := httptest.NewRequest("GET", "/limited", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected first request from %s to be allowed, got %d", addr, w.Code)
+		}
+	}
+}
+
+// newKeyRateLimitedRouter limits requests authenticated with keys created on
+// the given plans, indexed like plans.
+func newKeyRateLimitedRouter(t *testing.T, limit interfaces.RateLimit, plans ...string) (*gin.Engine, []string) {
+	t.Helper()
+	limiter, err := ratelimit.NewMemory(ratelimit.AlgorithmSlidingLog)
+	if err != nil {
+		t.Fatalf("NewMemory failed: %v", err)
+	}
+
+	apiKeys := repository.NewMemoryAPIKeyRepository(repository.NewMemoryStore())
+	keys := make([]string, len(plans))
+	for i, plan := range plans {
+		keys[i] = fmt.Sprintf("us_rate-limit-test-%d", i)
+		_, err := apiKeys.CreateAPIKey(context.Background(), &models.APIKey{OwnerID: "team", KeyHash: auth.HashAPIKey(keys[i]), Plan: plan})
+		if err != nil {
+			t.Fatalf("CreateAPIKey failed: %v", err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/limited", auth.Middleware(apiKeys), RateLimit(limiter, "test", limit), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r, keys
+}
+
+func serveWithKey(r *gin.Engine, key, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/limited", nil)
+	req.Header.Set(auth.APIKeyHeader, key)
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit_APIKeyIdentity(t *testing.T) {
+	r, keys := newKeyRateLimitedRouter(t, interfaces.RateLimit{Requests: 1, Period: time.Minute}, "unlimited", "unlimited")
+
+	// Keys behind the same NAT are limited separately
+	for _, key := range keys {
+		if w := serveWithKey(r, key, "192.0.2.1:1234"); w.Code != http.StatusOK {
+			t.Errorf("Expected first request with %s to be allowed, got %d", key, w.Code)
+		}
+	}
+
+	// A key is limited wherever it is used from
+	if w := serveWithKey(r, keys[0], "192.0.2.2:1234"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected second request with %s from another IP to be limited, got %d", keys[0], w.Code)
+	}
+}
+
+func TestRateLimit_PlanRequestsPerMinute(t *testing.T) {
+	perMinute := repository.DefaultPlans["free"].RequestsPerMinute
+	r, keys := newKeyRateLimitedRouter(t, interfaces.RateLimit{}, "free")
+
+	for i := 0; i < perMinute; i++ {
+		if w := serveWithKey(r, keys[0], "192.0.2.1:1234"); w.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status %d, got %d", i+1, http.StatusOK, w.Code)
+		}
+	}
+
+	w := serveWithKey(r, keys[0], "192.0.2.1:1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the plan's limit of %d requests per minute to apply, got %d", perMinute, w.Code)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != strconv.Itoa(perMinute) {
+		t.Errorf("Expected RateLimit-Limit %d, got %q", perMinute, got)
+	}
+}
+
+func TestRateLimit_ReportsClosestLimit(t *testing.T) {
+	perMinute := repository.DefaultPlans["free"].RequestsPerMinute
+	r, keys := newKeyRateLimitedRouter(t, interfaces.RateLimit{Requests: perMinute * 2, Period: time.Minute}, "free")
+
+	w := serveWithKey(r, keys[0], "192.0.2.1:1234")
+	if got := w.Header().Get("RateLimit-Remaining"); got != strconv.Itoa(perMinute-1) {
+		t.Errorf("Expected RateLimit-Remaining %d from the plan, got %q", perMinute-1, got)
+	}
+}
+
+func TestRateLimit_Passthrough(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter interfaces.RateLimiter
+		limit   interfaces.RateLimit
+	}{
+		{"limiter error", failingLimiter{}, interfaces.RateLimit{Requests: 1, Period: time.Minute}},
+		{"no limiter", nil, interfaces.RateLimit{Requests: 1, Period: time.Minute}},
+		{"zero limit", failingLimiter{}, interfaces.RateLimit{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRateLimitedRouter(tt.limiter, tt.limit)
+			for i := 0; i < 3; i++ {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest("GET", "/limited", nil))
+				if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+					t.Fatalf("Expected unlimited request without headers, got %d %v", w.Code, w.Header())
+				}
+			}
+		})
+	}
+}
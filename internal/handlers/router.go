@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jonmanahan/url-shortener/internal/auth"
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+)
+
+// NewRouter registers every route served by the API. Creating and managing
+// links requires an API key looked up in apiKeys; resolving stays anonymous.
+// Requests are counted by limiter against limits, falling back to
+// DefaultRateLimits for routes not listed, per API key when there is one and
+// per client IP otherwise.
+func NewRouter(h *Handlers, apiKeys interfaces.APIKeyRepository, limiter interfaces.RateLimiter, limits map[string]interfaces.RateLimit) *gin.Engine {
+	r := gin.Default()
+
+	limit := func(route string) gin.HandlerFunc {
+		return RateLimit(limiter, route, routeLimit(limits, route))
+	}
+
+	// Health checks and probes
+	r.GET("/health", h.Health)
+	r.GET("/livez", h.Livez)
+	r.GET("/readyz", h.Readyz)
+
+	// Creating and managing links needs the database, including the API
+	// key lookup, so these routes answer 503 while it is down. Redirects
+	// keep being served from the cache. Key lookups are limited per IP
+	// first, so guessing keys cannot put unbounded load on the database.
+	authenticated := r.Group("", h.RequireDependencies, limit(RouteAuth), auth.Middleware(apiKeys))
+
+	// URL shortener endpoints
+	authenticated.POST("/shorten", limit(RouteShorten), h.Shorten)
+	r.GET("/:shortCode", limit(RouteResolve), h.Resolve)
+	r.GET("/:shortCode/qr", limit(RouteResolve), h.QRCode)
+
+	// Link management endpoints
+	api := authenticated.Group("/api")
+	api.POST("/shorten/batch", limit(RouteBatch), h.ShortenBatch)
+	api.GET("/usage", limit(RouteAPI), h.Usage)
+
+	links := api.Group("/links", limit(RouteAPI))
+	links.GET("", h.ListLinks)
+	links.GET("/:shortCode", h.GetLink)
+	links.PATCH("/:shortCode", h.UpdateLink)
+	links.DELETE("/:shortCode", h.DeleteLink)
+	links.GET("/:shortCode/stats", h.Stats)
+
+	return r
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonmanahan/url-shortener/internal/auth"
+	"github.com/jonmanahan/url-shortener/internal/config"
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+	"github.com/jonmanahan/url-shortener/internal/ratelimit"
+	"github.com/jonmanahan/url-shortener/internal/repository"
+	"github.com/jonmanahan/url-shortener/internal/service"
+)
+
+const testAPIKey = "us_integration-test-key"
+
+// newMemoryRouter wires the real services and router on in-memory storage,
+// with testAPIKey on the default plan.
+func newMemoryRouter(t *testing.T, limits map[string]interfaces.RateLimit) (*gin.Engine, *service.AnalyticsService) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := repository.NewMemoryStore()
+	urls := repository.NewMemoryURLRepository(store)
+	apiKeys := repository.NewMemoryAPIKeyRepository(store)
+	_, err := apiKeys.CreateAPIKey(context.Background(), &models.APIKey{
+		OwnerID: "owner-1",
+		Name:    "test",
+		KeyHash: auth.HashAPIKey(testAPIKey),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+
+	cfg := &config.Config{BaseURL: "https://sho.rt", DefaultRedirectType: http.StatusFound}
+	urlService := service.NewURLService(urls, repository.NewMemoryCache(), nil, cfg)
+	analyticsService := service.NewAnalyticsService(repository.NewMemoryClickRepository(store), urls, cfg)
+	t.Cleanup(analyticsService.Close)
+
+	limiter, err := ratelimit.NewMemory(ratelimit.AlgorithmSlidingWindow)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+
+	quotaService := service.NewQuotaService(repository.NewMemoryUsageRepository(store))
+
+	return NewRouter(New(urlService, analyticsService, quotaService), apiKeys, limiter, limits), analyticsService
+}
+
+func serve(r *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.APIKeyHeader, testAPIKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRouter_MemoryStorage_LinkLifecycle(t *testing.T) {
+	r, analytics := newMemoryRouter(t, nil)
+
+	// Creating links requires an API key
+	req := httptest.NewRequest("POST", "/shorten", bytes.NewBufferString(`{"url":"https://example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status %d without API key, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// Runtime counters are only served on the admin listener
+	if w := serve(r, "GET", "/debug/vars", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for /debug/vars, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w = serve(r, "POST", "/shorten", models.ShortenRequest{URL: "https://example.com/a"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+	var created models.ShortenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	w = serve(r, "GET", "/"+created.ShortCode, nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/a" {
+		t.Fatalf("Expected redirect to https://example.com/a, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	// Alias conflicts surface through the real repository
+	w = serve(r, "POST", "/shorten", models.ShortenRequest{URL: "https://example.com/b", Alias: created.ShortCode})
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for taken alias, got %d", http.StatusConflict, w.Code)
+	}
+
+	w = serve(r, "GET", "/api/links", nil)
+	var list models.URLList
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to unmarshal list: %v", err)
+	}
+	if w.Code != http.StatusOK || list.Total != 1 {
+		t.Errorf("Expected one listed link, got status %d total %d", w.Code, list.Total)
+	}
+
+	// Updating invalidates the cached destination
+	w = serve(r, "PATCH", "/api/links/"+created.ShortCode, models.UpdateURLRequest{URL: "https://example.com/c"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	w = serve(r, "GET", "/"+created.ShortCode, nil)
+	if got := w.Header().Get("Location"); got != "https://example.com/c" {
+		t.Errorf("Expected redirect to updated destination, got %q", got)
+	}
+
+	// Closing the analytics service flushes the recorded clicks
+	analytics.Close()
+	w = serve(r, "GET", "/api/links/"+created.ShortCode+"/stats", nil)
+	var stats models.LinkStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to unmarshal stats: %v", err)
+	}
+	if stats.TotalClicks != 2 {
+		t.Errorf("Expected 2 clicks, got %d", stats.TotalClicks)
+	}
+
+	w = serve(r, "DELETE", "/api/links/"+created.ShortCode, nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	w = serve(r, "GET", "/"+created.ShortCode, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d after delete, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestRouter_MemoryStorage_ConcurrentShorten(t *testing.T) {
+	// Requests with the same key share a rate limit, so only the plan's
+	// limit applies
+	r, _ := newMemoryRouter(t, map[string]interfaces.RateLimit{RouteShorten: {}})
+
+	const clients = 50
+	codes := make([]string, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body, _ := json.Marshal(models.ShortenRequest{URL: fmt.Sprintf("https://example.com/%d", i)})
+			req := httptest.NewRequest("POST", "/shorten", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(auth.APIKeyHeader, testAPIKey)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			var resp models.ShortenResponse
+			if w.Code == http.StatusCreated && json.Unmarshal(w.Body.Bytes(), &resp) == nil {
+				codes[i] = resp.ShortCode
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool, clients)
+	for i, code := range codes {
+		if code == "" {
+			t.Fatalf("Request %d failed", i)
+		}
+		if seen[code] {
+			t.Fatalf("Short code %s issued twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestRouter_MemoryStorage_LinkQuota(t *testing.T) {
+	r, _ := newMemoryRouter(t, nil)
+	perDay := repository.DefaultPlans[models.DefaultPlan].LinksPerDay
+
+	batch := func(valid, invalid int) models.BatchShortenRequest {
+		var req models.BatchShortenRequest
+		for i := 0; i < valid; i++ {
+			req.Items = append(req.Items, models.ShortenRequest{URL: fmt.Sprintf("https://example.com/%d", i)})
+		}
+		for i := 0; i < invalid; i++ {
+			req.Items = append(req.Items, models.ShortenRequest{URL: "not a url"})
+		}
+		return req
+	}
+
+	// A batch larger than the daily quota is rejected as a whole
+	w := serve(r, "POST", "/api/shorten/batch", batch(perDay+1, 0))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected status %d with Retry-After, got %d %v", http.StatusTooManyRequests, w.Code, w.Header())
+	}
+
+	// Items that fail are given back
+	w = serve(r, "POST", "/api/shorten/batch", batch(2, 1))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	w = serve(r, "GET", "/api/usage", nil)
+	var usage models.Usage
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil {
+		t.Fatalf("Failed to unmarshal usage: %v", err)
+	}
+	if w.Code != http.StatusOK || usage.Plan != models.DefaultPlan || usage.LinksToday != 2 || usage.LinksThisMonth != 2 {
+		t.Errorf("Expected 2 links used on the %s plan, got status %d %+v", models.DefaultPlan, w.Code, usage)
+	}
+	if usage.Quota.LinksPerDay != perDay || !usage.DayResetsAt.After(time.Now()) {
+		t.Errorf("Expected the plan's quota and a future reset, got %+v", usage)
+	}
+
+	// Links returned by dedupe were not created and do not count
+	w = serve(r, "POST", "/shorten", models.ShortenRequest{URL: "https://example.com/0", Dedupe: true})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected deduplicated link, got %d: %s", w.Code, w.Body)
+	}
+
+	w = serve(r, "POST", "/api/shorten/batch", batch(perDay-2, 0))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	w = serve(r, "POST", "/shorten", models.ShortenRequest{URL: "https://example.com/new"})
+	var body struct {
+		Period string `json:"period"`
+		Limit  int    `json:"limit"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if w.Code != http.StatusTooManyRequests || body.Period != interfaces.QuotaPeriodDay || body.Limit != perDay {
+		t.Errorf("Expected the daily quota of %d to be exceeded, got %d: %s", perDay, w.Code, w.Body)
+	}
+}
+
+func TestRouter_MemoryStorage_BatchValidatesItems(t *testing.T) {
+	r, _ := newMemoryRouter(t, nil)
+
+	w := serve(r, "POST", "/api/shorten/batch", models.BatchShortenRequest{Items: []models.ShortenRequest{
+		{URL: "https://example.com/a"},
+		{URL: "https://example.com/b", RedirectType: 999},
+		{URL: "https://example.com/c", Alias: strings.Repeat("a", 80)},
+		{URL: "https://example.com/d", TTLSeconds: -5},
+		{URL: "not a url"},
+		{URL: "https://example.com/e", RedirectType: http.StatusTemporaryRedirect},
+	}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	var response models.BatchShortenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Succeeded != 2 || response.Failed != 4 {
+		t.Fatalf("Expected 2 succeeded and 4 failed, got %+v", response)
+	}
+	wantStatus := []int{http.StatusCreated, http.StatusBadRequest, http.StatusBadRequest, http.StatusBadRequest, http.StatusBadRequest, http.StatusCreated}
+	for i, result := range response.Results {
+		if result.Status != wantStatus[i] {
+			t.Errorf("Item %d: expected status %d, got %d (%s)", i, wantStatus[i], result.Status, result.Error)
+		}
+	}
+}
+
+func TestRouter_MemoryStorage_LimitsKeyLookupsPerIP(t *testing.T) {
+	r, _ := newMemoryRouter(t, map[string]interfaces.RateLimit{RouteAuth: {Requests: 2, Period: time.Minute}})
+
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("GET", "/api/links", nil)
+		req.Header.Set(auth.APIKeyHeader, fmt.Sprintf("us_guess-%d", i))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("Request %d: expected status %d, got %d", i+1, want, w.Code)
+		}
+	}
+}
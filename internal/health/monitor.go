@@ -0,0 +1,209 @@
+// Package health tracks whether the services the API depends on are
+// reachable.
+package health
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// pingTimeout bounds a single dependency check.
+	pingTimeout = 2 * time.Second
+	// minRetryInterval is the first retry delay after a dependency goes
+	// down; it doubles up to the monitor's check interval.
+	minRetryInterval = 500 * time.Millisecond
+)
+
+// Status is the last known state of a dependency.
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// PingFunc checks that a dependency is reachable.
+type PingFunc func(ctx context.Context) error
+
+// State describes a dependency as of its last check.
+type State struct {
+	Status Status `json:"status"`
+	// Required dependencies are needed to create and manage links, and an
+	// instance without them is not ready. The service keeps serving cached
+	// redirects either way.
+	Required bool `json:"required"`
+	// Since is when the dependency entered its current status.
+	Since     time.Time `json:"since"`
+	LastCheck time.Time `json:"last_check"`
+	// LatencyMS is how long the last check took, in milliseconds.
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Monitor checks a dependency in the background: every interval while it is
+// up, and with a growing delay (capped at interval) while it is down.
+type Monitor struct {
+	name     string
+	required bool
+	ping     PingFunc
+	interval time.Duration
+
+	mu        sync.RWMutex
+	state     State
+	nextCheck time.Time
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// NewMonitor checks the dependency once and then keeps checking it until
+// Close is called.
+func NewMonitor(name string, required bool, ping PingFunc, interval time.Duration) *Monitor {
+	m := &Monitor{
+		name:     name,
+		required: required,
+		ping:     ping,
+		interval: interval,
+		state:    State{Required: required},
+		done:     make(chan struct{}),
+	}
+
+	delay := m.check(0)
+
+	m.wg.Add(1)
+	go m.run(delay)
+
+	return m
+}
+
+// Name returns the dependency's name as reported by /health.
+func (m *Monitor) Name() string {
+	return m.name
+}
+
+// Required reports whether links can be created and managed without the
+// dependency.
+func (m *Monitor) Required() bool {
+	return m.required
+}
+
+// Available reports whether the last check succeeded.
+func (m *Monitor) Available() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.Status == StatusUp
+}
+
+// State returns the result of the last check.
+func (m *Monitor) State() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// RetryAfter is how long until the dependency is checked again, at least a
+// second. Clients told to come back later can wait this long.
+func (m *Monitor) RetryAfter() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if wait := time.Until(m.nextCheck).Round(time.Second); wait > time.Second {
+		return wait
+	}
+	return time.Second
+}
+
+// Close stops the background checks.
+func (m *Monitor) Close() {
+	m.once.Do(func() {
+		close(m.done)
+		m.wg.Wait()
+	})
+}
+
+func (m *Monitor) run(delay time.Duration) {
+	defer m.wg.Done()
+
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-m.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+			delay = m.check(delay)
+		}
+	}
+}
+
+// Check pings the dependency now, bounded by ctx and a short timeout, and
+// returns the updated state.
+func (m *Monitor) Check(ctx context.Context) State {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	m.probe(ctx)
+	return m.State()
+}
+
+// check pings the dependency and returns the delay until the next check
+// given the previous one.
+func (m *Monitor) check(previous time.Duration) time.Duration {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	err := m.probe(ctx)
+	cancel()
+
+	delay := m.interval
+	if err != nil {
+		delay = minRetryInterval
+		if previous < m.interval && previous*2 > delay {
+			delay = previous * 2
+		}
+		if delay > m.interval {
+			delay = m.interval
+		}
+	}
+
+	m.mu.Lock()
+	m.nextCheck = time.Now().Add(delay)
+	m.mu.Unlock()
+
+	return delay
+}
+
+// probe pings the dependency once and records the result.
+func (m *Monitor) probe(ctx context.Context) error {
+	start := time.Now()
+	err := m.ping(ctx)
+	now := time.Now()
+
+	status := StatusUp
+	if err != nil {
+		status = StatusDown
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if status != m.state.Status {
+		switch {
+		case err != nil:
+			log.Printf("Warning: %s unavailable, retrying in the background: %v", m.name, err)
+		case !m.state.LastCheck.IsZero():
+			log.Printf("%s available again", m.name)
+		}
+		m.state.Status = status
+		m.state.Since = now
+	}
+	m.state.LastCheck = now
+	m.state.LatencyMS = float64(now.Sub(start).Microseconds()) / 1000
+	m.state.Error = ""
+	if err != nil {
+		m.state.Error = err.Error()
+	}
+
+	return err
+}
@@ -0,0 +1,92 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeDependency fails its pings until up is set.
+type fakeDependency struct {
+	up    atomic.Bool
+	pings atomic.Int32
+}
+
+func (d *fakeDependency) ping(ctx context.Context) error {
+	d.pings.Add(1)
+	if !d.up.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMonitor_RetriesUntilAvailable(t *testing.T) {
+	dep := &fakeDependency{}
+	m := NewMonitor("database", true, dep.ping, 20*time.Millisecond)
+	defer m.Close()
+
+	state := m.State()
+	if m.Available() || state.Status != StatusDown || state.Error == "" || !state.Required {
+		t.Fatalf("Expected required dependency to start down with an error, got %+v", state)
+	}
+	if m.RetryAfter() < time.Second {
+		t.Errorf("Expected Retry-After of at least a second, got %v", m.RetryAfter())
+	}
+
+	// Keeps retrying in the background until the dependency comes up
+	dep.up.Store(true)
+	waitFor(t, m.Available)
+
+	state = m.State()
+	if state.Error != "" || !state.Since.After(time.Time{}) || state.LastCheck.Before(state.Since) {
+		t.Errorf("Unexpected state after recovery: %+v", state)
+	}
+
+	// And notices when it goes down again
+	dep.up.Store(false)
+	waitFor(t, func() bool { return !m.Available() })
+}
+
+func TestMonitor_CloseStopsChecks(t *testing.T) {
+	dep := &fakeDependency{}
+	dep.up.Store(true)
+	m := NewMonitor("redis", false, dep.ping, 5*time.Millisecond)
+	if !m.Available() || m.Required() {
+		t.Fatalf("Expected optional dependency to start up, got %+v", m.State())
+	}
+
+	m.Close()
+	m.Close()
+	pings := dep.pings.Load()
+	time.Sleep(30 * time.Millisecond)
+	if dep.pings.Load() != pings {
+		t.Errorf("Expected no pings after Close")
+	}
+}
+
+func TestMonitor_Check(t *testing.T) {
+	dep := &fakeDependency{}
+	m := NewMonitor("database", true, dep.ping, time.Hour)
+	defer m.Close()
+
+	// An on-demand check sees the recovery without waiting for the next
+	// background check
+	dep.up.Store(true)
+	state := m.Check(context.Background())
+	if state.Status != StatusUp || state.LatencyMS < 0 || !m.Available() {
+		t.Errorf("Expected dependency up after check, got %+v", state)
+	}
+}
@@ -0,0 +1,115 @@
+package interfaces
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Errors returned by URLService implementations. Handlers map these to HTTP
+// status codes, so implementations should wrap them rather than replace them.
+var (
+	// ErrInvalidURL is returned when a destination URL is malformed.
+	ErrInvalidURL = errors.New("invalid URL")
+	// ErrInvalidAlias is returned when a requested alias fails format validation
+	// or collides with a reserved route name.
+	ErrInvalidAlias = errors.New("invalid alias")
+	// ErrAliasTaken is returned when a requested alias is already in use.
+	ErrAliasTaken = errors.New("alias already taken")
+	// ErrInvalidDomain is returned when a request names a domain that is not
+	// configured as a short domain.
+	ErrInvalidDomain = errors.New("invalid domain")
+	// ErrInvalidExpiry is returned when a requested expiry is in the past or
+	// both an absolute expiry and a TTL were supplied.
+	ErrInvalidExpiry = errors.New("invalid expiry")
+	// ErrInvalidRedirectType is returned when a link asks for a redirect
+	// status other than 301, 302, 307 or 308.
+	ErrInvalidRedirectType = errors.New("invalid redirect type")
+	// ErrInvalidAPIKey is returned when an API key is unknown or revoked.
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrUnknownPlan is returned when an API key is created on a plan that
+	// does not exist.
+	ErrUnknownPlan = errors.New("unknown plan")
+	// ErrLinkNotFound is returned when no link exists for a short code.
+	ErrLinkNotFound = errors.New("link not found")
+	// ErrLinkExpired is returned when resolving a link past its expiry.
+	ErrLinkExpired = errors.New("link expired")
+)
+
+// ErrURLRejected is returned when a well-formed destination is refused by the
+// URL policy. The returned error is a *PolicyError naming the rule that fired.
+var ErrURLRejected = errors.New("URL rejected by policy")
+
+// PolicyError reports which URL policy rule rejected a destination and why.
+// It wraps ErrURLRejected.
+type PolicyError struct {
+	Rule   string
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrURLRejected, e.Reason)
+}
+
+func (e *PolicyError) Unwrap() error {
+	return ErrURLRejected
+}
+
+// ErrKeyspaceExhausted is returned when no unused short code could be found
+// within the allowed number of attempts, which suggests the code space for the
+// domain is close to full. The returned error is a *KeyspaceExhaustedError.
+var ErrKeyspaceExhausted = errors.New("short code keyspace exhausted")
+
+// KeyspaceExhaustedError reports a failure to allocate a free short code on a
+// domain. It wraps ErrKeyspaceExhausted.
+type KeyspaceExhaustedError struct {
+	Domain   string
+	Attempts int
+}
+
+func (e *KeyspaceExhaustedError) Error() string {
+	return fmt.Sprintf("%s: no free code after %d attempts", ErrKeyspaceExhausted, e.Attempts)
+}
+
+func (e *KeyspaceExhaustedError) Unwrap() error {
+	return ErrKeyspaceExhausted
+}
+
+// ErrQuotaExceeded is returned when creating links would exceed an API key's
+// daily or monthly quota. The returned error is a *QuotaExceededError.
+var ErrQuotaExceeded = errors.New("link quota exceeded")
+
+// Quota periods reported by QuotaExceededError.
+const (
+	QuotaPeriodDay   = "day"
+	QuotaPeriodMonth = "month"
+)
+
+// QuotaExceededError reports which link quota of an API key would be
+// exceeded. It wraps ErrQuotaExceeded.
+type QuotaExceededError struct {
+	// Period is QuotaPeriodDay or QuotaPeriodMonth.
+	Period string
+	Limit  int
+	// Used is how many links the key already created in the period.
+	Used int
+	// ResetsAt is when the period ends and the count starts over.
+	ResetsAt time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s: %d of %d links per %s used", ErrQuotaExceeded, e.Used, e.Limit, e.Period)
+}
+
+func (e *QuotaExceededError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// Errors returned by repository implementations.
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write would break a uniqueness
+	// constraint, such as a short code already in use on its domain.
+	ErrConflict = errors.New("conflict")
+)
@@ -2,20 +2,151 @@ package interfaces
 
 import (
 	"context"
+	"time"
 
 	"github.com/jonmanahan/url-shortener/internal/models"
 )
 
-// URLRepository interface for URL storage operations
+// URLRepository interface for URL storage operations. Implementations must
+// honor cancellation and deadlines on ctx and report missing links with
+// ErrNotFound and taken short codes with ErrConflict.
 type URLRepository interface {
-	CreateURL(originalURL, shortCode string) (*models.URL, error)
-	GetURLByShortCode(shortCode string) (*models.URL, error)
-	ShortCodeExists(shortCode string) (bool, error)
+	// CreateURL returns ErrConflict if the short code is taken on the domain.
+	CreateURL(ctx context.Context, url *models.URL) (*models.URL, error)
+	// CreateURLs inserts the links atomically, skipping links whose short
+	// code is taken, and returns only the links inserted.
+	CreateURLs(ctx context.Context, urls []*models.URL) ([]*models.URL, error)
+	GetURLByShortCode(ctx context.Context, domain, shortCode string) (*models.URL, error)
+	// UpdateURL changes the destination and redirect type of an existing link.
+	UpdateURL(ctx context.Context, url *models.URL) (*models.URL, error)
+	// DeleteURL also deletes the link's clicks. They are keyed by domain and
+	// short code, so a new link reusing the code would otherwise inherit them.
+	DeleteURL(ctx context.Context, domain, shortCode string) error
+	// ListURLsByOwner returns one page of an owner's links across all
+	// domains, newest first, along with the owner's total link count.
+	ListURLsByOwner(ctx context.Context, ownerID string, limit, offset int) ([]*models.URL, int, error)
+	// FindURLByDestination returns the owner's oldest unexpired link on
+	// domain with the given destination hash, or ErrNotFound.
+	FindURLByDestination(ctx context.Context, ownerID, domain, destinationHash string) (*models.URL, error)
+}
+
+// CodeGenerator produces candidate short codes for new links. Codes are not
+// guaranteed to be unused; callers rely on the repository to reject
+// duplicates.
+type CodeGenerator interface {
+	Generate(ctx context.Context) (string, error)
+}
+
+// KeyPoolRepository stores pre-generated short codes. Pooled codes are not
+// used by any link on any domain.
+type KeyPoolRepository interface {
+	// AddCodes pools codes, skipping ones already pooled or used by a link,
+	// and returns how many were added.
+	AddCodes(ctx context.Context, codes []string) (int, error)
+	// LeaseCodes removes up to n codes from the pool and returns them. Each
+	// code is leased at most once.
+	LeaseCodes(ctx context.Context, n int) ([]string, error)
+	AvailableCodes(ctx context.Context) (int, error)
+}
+
+// ClickRepository interface for click event storage and aggregation
+type ClickRepository interface {
+	InsertClicks(ctx context.Context, events []models.ClickEvent) error
+	// GetLinkStats aggregates clicks for a link: the all-time total, daily
+	// counts over the last days days, and the topReferrers most common
+	// referrers.
+	GetLinkStats(ctx context.Context, domain, shortCode string, days, topReferrers int) (*models.LinkStats, error)
+}
+
+// APIKeyRepository interface for API key storage operations
+type APIKeyRepository interface {
+	// CreateAPIKey puts the key on models.DefaultPlan if it names no plan.
+	// It returns ErrUnknownPlan if the plan does not exist and ErrConflict
+	// if a key with the same hash already exists.
+	CreateAPIKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error)
+	// GetAPIKeyByHash returns the active (non-revoked) key with its plan's
+	// quota, or ErrInvalidAPIKey.
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+}
+
+// UsageRepository counts the links created with each API key per UTC day.
+type UsageRepository interface {
+	// ReserveLinks counts n links created with the key at now, unless that
+	// would exceed its daily or monthly quota. Then it counts nothing and
+	// returns a *QuotaExceededError. Concurrent reservations for the same
+	// key never exceed the quota together.
+	ReserveLinks(ctx context.Context, key *models.APIKey, n int, now time.Time) error
+	// ReleaseLinks uncounts n links reserved at now that were not created.
+	ReleaseLinks(ctx context.Context, keyID, n int, now time.Time) error
+	// CountLinks returns how many links were counted for the key on now's
+	// day and in now's month.
+	CountLinks(ctx context.Context, keyID int, now time.Time) (day, month int, err error)
+}
+
+// CacheEntry is a single key written by Cache.SetMany.
+type CacheEntry struct {
+	Key        string
+	Value      string
+	Expiration time.Duration
+}
+
+// Cache is the key/value store used for link lookups. Get returns an error
+// for missing or expired keys.
+type Cache interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key, value string, expiration time.Duration) error
+	// SetMany writes all entries, in a single round trip where supported.
+	SetMany(ctx context.Context, entries []CacheEntry) error
+	Del(ctx context.Context, keys ...string) error
+}
+
+// RateLimit allows Requests per Period. Zero Requests means no limit.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// RateLimitResult is the outcome of counting one request against a limit.
+type RateLimitResult struct {
+	Allowed bool
+	Limit   int
+	// Remaining is how many more requests would be allowed right now.
+	Remaining int
+	// Reset is how long until the limit is fully replenished.
+	Reset time.Duration
+	// RetryAfter is how long until a request would be allowed again; zero
+	// when this one was.
+	RetryAfter time.Duration
+}
+
+// RateLimiter counts requests per key. Rejected requests are not counted.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
 }
 
 // URLService interface for URL business logic operations
 type URLService interface {
-	ShortenURL(ctx context.Context, originalURL string) (*models.ShortenResponse, error)
-	ResolveURL(ctx context.Context, shortCode string) (string, error)
-	CheckRateLimit(ctx context.Context, clientIP string) (bool, error)
+	ShortenURL(ctx context.Context, req *models.ShortenRequest) (*models.ShortenResponse, error)
+	ShortenURLs(ctx context.Context, req *models.BatchShortenRequest) ([]models.BatchShortenResult, error)
+	ResolveURL(ctx context.Context, host, shortCode string) (*models.URL, error)
+	ShortURL(ctx context.Context, host, shortCode string) (string, error)
+	ListURLs(ctx context.Context, ownerID string, page, pageSize int) (*models.URLList, error)
+	GetURL(ctx context.Context, ownerID, domain, shortCode string) (*models.URL, error)
+	UpdateURL(ctx context.Context, ownerID, domain, shortCode string, req *models.UpdateURLRequest) (*models.URL, error)
+	DeleteURL(ctx context.Context, ownerID, domain, shortCode string) error
+}
+
+// QuotaService enforces the link quotas of API keys
+type QuotaService interface {
+	// ReserveLinks reserves n links against the key's quota. The returned
+	// function must be called with how many links were created, so the
+	// rest are given back. A nil key is not limited.
+	ReserveLinks(ctx context.Context, key *models.APIKey, n int) (func(created int), error)
+	Usage(ctx context.Context, key *models.APIKey) (*models.Usage, error)
+}
+
+// AnalyticsService interface for click tracking and reporting
+type AnalyticsService interface {
+	RecordClick(event models.ClickEvent)
+	GetLinkStats(ctx context.Context, ownerID, domain, shortCode string) (*models.LinkStats, error)
 }
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// APIKey authenticates API clients. Only a hash of the key is stored; the
+// OwnerID scopes which links the key can see and manage.
+type APIKey struct {
+	ID        int        `json:"id" db:"id"`
+	OwnerID   string     `json:"owner_id" db:"owner_id"`
+	Name      string     `json:"name" db:"name"`
+	KeyHash   string     `json:"-" db:"key_hash"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	// Plan names the plan whose quota applies to the key. Keys created
+	// without one get DefaultPlan.
+	Plan string `json:"plan" db:"plan"`
+	// Quota is filled in from the plan when the key is looked up.
+	Quota Quota `json:"quota"`
+}
+
+// DefaultPlan is assigned to API keys created without a plan.
+const DefaultPlan = "free"
+
+// Quota limits what an API key may do. Zero means unlimited. Days and
+// months are calendar days and months in UTC.
+type Quota struct {
+	RequestsPerMinute int `json:"requests_per_minute"`
+	LinksPerDay       int `json:"links_per_day"`
+	LinksPerMonth     int `json:"links_per_month"`
+}
+
+// QuotaResets returns when the UTC day and month that now falls in end, which
+// is when daily and monthly link counts start over.
+func QuotaResets(now time.Time) (day, month time.Time) {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC), time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Plan is a named quota shared by API keys.
+type Plan struct {
+	Name string `json:"name"`
+	Quota
+}
+
+// Usage reports how much of its quota an API key has used.
+type Usage struct {
+	Plan           string    `json:"plan"`
+	Quota          Quota     `json:"quota"`
+	LinksToday     int       `json:"links_today"`
+	LinksThisMonth int       `json:"links_this_month"`
+	DayResetsAt    time.Time `json:"day_resets_at"`
+	MonthResetsAt  time.Time `json:"month_resets_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// ClickEvent is a single resolve of a short link.
+type ClickEvent struct {
+	ShortCode string `json:"short_code" db:"short_code"`
+	Domain    string `json:"domain,omitempty" db:"domain"`
+	// Host is the request Host header; the analytics service maps it to Domain.
+	Host      string    `json:"-" db:"-"`
+	ClickedAt time.Time `json:"clicked_at" db:"clicked_at"`
+	Referrer  string    `json:"referrer" db:"referrer"`
+	UserAgent string    `json:"user_agent" db:"user_agent"`
+	IPAddress string    `json:"ip_address" db:"ip_address"`
+}
+
+type DailyClicks struct {
+	Date   string `json:"date"`
+	Clicks int64  `json:"clicks"`
+}
+
+type ReferrerCount struct {
+	Referrer string `json:"referrer"`
+	Clicks   int64  `json:"clicks"`
+}
+
+type LinkStats struct {
+	ShortCode    string          `json:"short_code"`
+	Domain       string          `json:"domain,omitempty"`
+	TotalClicks  int64           `json:"total_clicks"`
+	ClicksPerDay []DailyClicks   `json:"clicks_per_day"`
+	TopReferrers []ReferrerCount `json:"top_referrers"`
+}
@@ -3,19 +3,113 @@ package models
 import "time"
 
 type URL struct {
-	ID          int       `json:"id" db:"id"`
-	OriginalURL string    `json:"original_url" db:"original_url"`
-	ShortCode   string    `json:"short_code" db:"short_code"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID          int    `json:"id" db:"id"`
+	OriginalURL string `json:"original_url" db:"original_url"`
+	// NormalizedURL is the canonical form of OriginalURL used for dedupe and
+	// policy checks; links still redirect to OriginalURL.
+	NormalizedURL string `json:"normalized_url,omitempty" db:"normalized_url"`
+	ShortCode     string `json:"short_code" db:"short_code"`
+	Domain        string `json:"domain,omitempty" db:"domain"`
+	OwnerID       string `json:"owner_id,omitempty" db:"owner_id"`
+	// DestinationHash is the SHA-256 hex digest of NormalizedURL.
+	DestinationHash string `json:"-" db:"destination_hash"`
+	// RedirectType is the HTTP status sent when resolving: 301, 302, 307 or 308.
+	RedirectType int        `json:"redirect_type" db:"redirect_type"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// IsPermanentRedirect reports whether the link uses a redirect status that
+// browsers may cache (301 or 308).
+func (u *URL) IsPermanentRedirect() bool {
+	return u.RedirectType == 301 || u.RedirectType == 308
+}
+
+// RedirectStatus returns the link's redirect type, or 302 if it holds a
+// status that is not a valid redirect type.
+func (u *URL) RedirectStatus() int {
+	if !IsValidRedirectType(u.RedirectType) {
+		return 302
+	}
+	return u.RedirectType
+}
+
+// IsValidRedirectType reports whether a link may use status as its redirect
+// type, mirroring the urls_redirect_type_valid check constraint.
+func IsValidRedirectType(status int) bool {
+	return status == 301 || status == 302 || status == 307 || status == 308
+}
+
+// IsExpired reports whether the link has an expiry at or before now.
+func (u *URL) IsExpired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
 }
 
 type ShortenRequest struct {
-	URL string `json:"url" binding:"required,url"`
+	URL   string `json:"url" binding:"required,url"`
+	Alias string `json:"alias,omitempty" binding:"omitempty,max=32"`
+	// Domain selects one of the configured short domains; empty means the
+	// primary domain.
+	Domain string `json:"domain,omitempty" binding:"omitempty,max=255"`
+	// ExpiresAt and TTLSeconds are mutually exclusive ways to set an expiry.
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds int64      `json:"ttl_seconds,omitempty" binding:"omitempty,min=1"`
+	// RedirectType overrides the configured default redirect status.
+	RedirectType int `json:"redirect_type,omitempty" binding:"omitempty,oneof=301 302 307 308"`
+	// Dedupe returns the owner's existing live link to the same destination
+	// on the same domain instead of creating a new one. Ignored with Alias.
+	Dedupe bool `json:"dedupe,omitempty"`
+	// OwnerID is set from the authenticated API key, never from the body.
+	OwnerID string `json:"-"`
 }
 
 type ShortenResponse struct {
-	ShortCode   string `json:"short_code"`
-	OriginalURL string `json:"original_url"`
-	ShortURL    string `json:"short_url"`
+	ShortCode    string     `json:"short_code"`
+	OriginalURL  string     `json:"original_url"`
+	ShortURL     string     `json:"short_url"`
+	Domain       string     `json:"domain,omitempty"`
+	RedirectType int        `json:"redirect_type"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	// Deduplicated is set when an existing link was returned instead of
+	// creating a new one.
+	Deduplicated bool `json:"deduplicated,omitempty"`
+}
+
+type BatchShortenRequest struct {
+	// Items are validated individually by the service, not by binding, so one
+	// bad entry does not fail the batch.
+	Items   []ShortenRequest `json:"items" binding:"required,min=1,max=1000"`
+	OwnerID string           `json:"-"`
+}
+
+// BatchShortenResult is the outcome for one item of a batch, in request order.
+// Exactly one of the embedded response or Error is set.
+type BatchShortenResult struct {
+	Index  int `json:"index"`
+	Status int `json:"status"`
+	*ShortenResponse
+	Error string `json:"error,omitempty"`
+	// Rule names the URL policy rule that rejected the item, if any.
+	Rule string `json:"rule,omitempty"`
+	Err  error  `json:"-"`
+}
+
+type BatchShortenResponse struct {
+	Results   []BatchShortenResult `json:"results"`
+	Succeeded int                  `json:"succeeded"`
+	Failed    int                  `json:"failed"`
+}
+
+// UpdateURLRequest changes a link's destination, redirect type, or both.
+type UpdateURLRequest struct {
+	URL          string `json:"url,omitempty" binding:"required_without=RedirectType,omitempty,url"`
+	RedirectType int    `json:"redirect_type,omitempty" binding:"omitempty,oneof=301 302 307 308"`
+}
+
+type URLList struct {
+	URLs     []*URL `json:"urls"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+	Total    int    `json:"total"`
 }
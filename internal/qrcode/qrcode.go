@@ -0,0 +1,220 @@
+// Package qrcode renders QR codes for short links as PNG or SVG images and
+// keeps recently rendered images in a small in-memory LRU cache.
+package qrcode
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"sync"
+
+	qr "github.com/skip2/go-qrcode"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	DefaultSize   = 256
+	MinSize       = 64
+	MaxSize       = 2048
+	DefaultMargin = 4
+	MaxMargin     = 16
+	DefaultLevel  = "M"
+)
+
+// ErrInvalidOptions is returned for unsupported format, size, margin or level.
+var ErrInvalidOptions = errors.New("invalid QR code options")
+
+var levels = map[string]qr.RecoveryLevel{
+	"L": qr.Low,
+	"M": qr.Medium,
+	"Q": qr.High,
+	"H": qr.Highest,
+}
+
+// Options controls how a QR code is rendered. Size is the image width and
+// height in pixels; Margin is the quiet zone width in modules.
+type Options struct {
+	Format string
+	Size   int
+	Margin int
+	Level  string
+}
+
+// DefaultOptions returns a 256px PNG with the standard 4-module quiet zone
+// and medium error correction.
+func DefaultOptions() Options {
+	return Options{
+		Format: FormatPNG,
+		Size:   DefaultSize,
+		Margin: DefaultMargin,
+		Level:  DefaultLevel,
+	}
+}
+
+// Validate normalizes case and checks every option is in range.
+func (o *Options) Validate() error {
+	o.Format = strings.ToLower(o.Format)
+	o.Level = strings.ToUpper(o.Level)
+
+	if o.Format != FormatPNG && o.Format != FormatSVG {
+		return fmt.Errorf("%w: format must be png or svg", ErrInvalidOptions)
+	}
+	if o.Size < MinSize || o.Size > MaxSize {
+		return fmt.Errorf("%w: size must be between %d and %d", ErrInvalidOptions, MinSize, MaxSize)
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("%w: margin must be between 0 and %d", ErrInvalidOptions, MaxMargin)
+	}
+	if _, ok := levels[o.Level]; !ok {
+		return fmt.Errorf("%w: level must be one of L, M, Q, H", ErrInvalidOptions)
+	}
+	return nil
+}
+
+// ContentType returns the MIME type of images rendered with these options.
+func (o Options) ContentType() string {
+	if o.Format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Generator renders QR codes, caching the most recently used images.
+type Generator struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key   string
+	image []byte
+}
+
+// NewGenerator returns a Generator caching up to capacity rendered images.
+func NewGenerator(capacity int) *Generator {
+	return &Generator{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Generate renders content as a QR code. opts must already be validated.
+func (g *Generator) Generate(content string, opts Options) ([]byte, error) {
+	key := fmt.Sprintf("%s|%d|%d|%s|%s", opts.Format, opts.Size, opts.Margin, opts.Level, content)
+	if image, ok := g.get(key); ok {
+		return image, nil
+	}
+
+	code, err := qr.New(content, levels[opts.Level])
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	code.DisableBorder = true
+	modules := code.Bitmap()
+
+	var image []byte
+	if opts.Format == FormatSVG {
+		image = renderSVG(modules, opts)
+	} else {
+		image, err = renderPNG(modules, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	g.put(key, image)
+	return image, nil
+}
+
+func (g *Generator) get(key string) ([]byte, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if el, ok := g.entries[key]; ok {
+		g.order.MoveToFront(el)
+		return el.Value.(*cacheEntry).image, true
+	}
+	return nil, false
+}
+
+func (g *Generator) put(key string, image []byte) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.capacity <= 0 {
+		return
+	}
+	if el, ok := g.entries[key]; ok {
+		g.order.MoveToFront(el)
+		return
+	}
+	g.entries[key] = g.order.PushFront(&cacheEntry{key: key, image: image})
+	for g.order.Len() > g.capacity {
+		oldest := g.order.Back()
+		g.order.Remove(oldest)
+		delete(g.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// renderPNG draws each module as an integer number of pixels, centered in a
+// Size x Size image so modules stay crisp.
+func renderPNG(modules [][]bool, opts Options) ([]byte, error) {
+	total := len(modules) + 2*opts.Margin
+	scale := opts.Size / total
+	if scale < 1 {
+		return nil, fmt.Errorf("%w: size %d is too small for this URL", ErrInvalidOptions, opts.Size)
+	}
+	offset := (opts.Size-total*scale)/2 + opts.Margin*scale
+
+	img := image.NewPaletted(image.Rect(0, 0, opts.Size, opts.Size), color.Palette{color.White, color.Black})
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				for px := 0; px < scale; px++ {
+					img.SetColorIndex(offset+x*scale+px, offset+y*scale+py, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// renderSVG emits one path covering all dark modules, in module units scaled
+// to Size by the viewBox.
+func renderSVG(modules [][]bool, opts Options) []byte {
+	total := len(modules) + 2*opts.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, total, total)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#ffffff"/>`, total, total)
+	buf.WriteString(`<path fill="#000000" d="`)
+	for y, row := range modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+opts.Margin, y+opts.Margin)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
@@ -0,0 +1,91 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"defaults", DefaultOptions(), false},
+		{"svg upper case", Options{Format: "SVG", Size: 512, Margin: 0, Level: "h"}, false},
+		{"bad format", Options{Format: "gif", Size: 256, Margin: 4, Level: "M"}, true},
+		{"too small", Options{Format: "png", Size: 10, Margin: 4, Level: "M"}, true},
+		{"too large", Options{Format: "png", Size: 100000, Margin: 4, Level: "M"}, true},
+		{"negative margin", Options{Format: "png", Size: 256, Margin: -1, Level: "M"}, true},
+		{"bad level", Options{Format: "png", Size: 256, Margin: 4, Level: "X"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("Expected ErrInvalidOptions, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGenerator_PNG(t *testing.T) {
+	g := NewGenerator(10)
+
+	opts := DefaultOptions()
+	data, err := g.Generate("https://sho.rt/abc123", opts)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected a valid PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != opts.Size || b.Dy() != opts.Size {
+		t.Errorf("Expected %dx%d image, got %dx%d", opts.Size, opts.Size, b.Dx(), b.Dy())
+	}
+
+	// The corner pixel is inside the quiet zone and must be white
+	if r, g, b, _ := img.At(0, 0).RGBA(); r != 0xffff || g != 0xffff || b != 0xffff {
+		t.Errorf("Expected white margin, got %v", img.At(0, 0))
+	}
+}
+
+func TestGenerator_SVG(t *testing.T) {
+	g := NewGenerator(10)
+
+	opts := Options{Format: FormatSVG, Size: 300, Margin: 2, Level: "Q"}
+	data, err := g.Generate("https://sho.rt/abc123", opts)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	svg := string(data)
+	if !strings.Contains(svg, `<svg`) || !strings.Contains(svg, `width="300"`) || !strings.Contains(svg, `<path`) {
+		t.Errorf("Unexpected SVG output: %.200s", svg)
+	}
+}
+
+func TestGenerator_Cache(t *testing.T) {
+	g := NewGenerator(1)
+	opts := DefaultOptions()
+
+	first, _ := g.Generate("https://sho.rt/a", opts)
+	again, _ := g.Generate("https://sho.rt/a", opts)
+	if &first[0] != &again[0] {
+		t.Error("Expected repeated request to be served from cache")
+	}
+
+	_, _ = g.Generate("https://sho.rt/b", opts)
+	if _, ok := g.get("png|256|4|M|https://sho.rt/a"); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+}
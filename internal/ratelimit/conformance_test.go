@@ -0,0 +1,19 @@
+package ratelimit_test
+
+import (
+	"testing"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/ratelimit"
+	"github.com/jonmanahan/url-shortener/internal/ratelimit/ratelimittest"
+)
+
+func TestMemory_Conformance(t *testing.T) {
+	ratelimittest.TestRateLimiter(t, func(t *testing.T, algorithm string) interfaces.RateLimiter {
+		limiter, err := ratelimit.NewMemory(algorithm)
+		if err != nil {
+			t.Fatalf("NewMemory failed: %v", err)
+		}
+		return limiter
+	})
+}
@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+)
+
+// memorySweepEvery is how many checks pass between sweeps of keys that no
+// longer affect any limit.
+const memorySweepEvery = 1024
+
+// memoryKey is the state of one key; which fields are used depends on the
+// algorithm.
+type memoryKey struct {
+	// log holds the request times within the period, oldest first.
+	log []time.Time
+	// window is the index of the current fixed window, with prev and
+	// curr the requests counted in the previous and current one.
+	window     int64
+	prev, curr int
+	// tat is GCRA's theoretical arrival time.
+	tat time.Time
+	// expiresAt is when the key no longer affects its limit.
+	expiresAt time.Time
+}
+
+// Memory is an in-process interfaces.RateLimiter. It is safe for concurrent
+// use, but limits are per instance.
+type Memory struct {
+	algorithm string
+	now       func() time.Time
+
+	mu     sync.Mutex
+	keys   map[string]*memoryKey
+	checks int
+}
+
+// NewMemory returns an in-process limiter using the given algorithm.
+func NewMemory(algorithm string) (*Memory, error) {
+	algorithm, err := Normalize(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &Memory{
+		algorithm: algorithm,
+		now:       time.Now,
+		keys:      make(map[string]*memoryKey),
+	}, nil
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, limit interfaces.RateLimit) (interfaces.RateLimitResult, error) {
+	if err := ctx.Err(); err != nil {
+		return interfaces.RateLimitResult{}, err
+	}
+	if Disabled(limit) {
+		return interfaces.RateLimitResult{Allowed: true}, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	k, ok := m.keys[key]
+	if !ok {
+		k = &memoryKey{}
+		m.keys[key] = k
+	}
+
+	var result interfaces.RateLimitResult
+	switch m.algorithm {
+	case AlgorithmSlidingLog:
+		result = k.slidingLog(limit, now)
+	case AlgorithmTokenBucket:
+		result = k.tokenBucket(limit, now)
+	default:
+		result = k.slidingWindow(limit, now)
+	}
+
+	m.checks++
+	if m.checks%memorySweepEvery == 0 {
+		for key, k := range m.keys {
+			if !now.Before(k.expiresAt) {
+				delete(m.keys, key)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (k *memoryKey) slidingLog(limit interfaces.RateLimit, now time.Time) interfaces.RateLimitResult {
+	cutoff := now.Add(-limit.Period)
+	i := 0
+	for i < len(k.log) && !k.log[i].After(cutoff) {
+		i++
+	}
+	k.log = k.log[i:]
+
+	allowed := len(k.log) < limit.Requests
+	if allowed {
+		k.log = append(k.log, now)
+	}
+
+	var oldestAge, newestAge time.Duration
+	if n := len(k.log); n > 0 {
+		oldestAge = now.Sub(k.log[0])
+		newestAge = now.Sub(k.log[n-1])
+		k.expiresAt = k.log[n-1].Add(limit.Period)
+	}
+	return SlidingLogResult(limit, allowed, len(k.log), oldestAge, newestAge)
+}
+
+func (k *memoryKey) slidingWindow(limit interfaces.RateLimit, now time.Time) interfaces.RateLimitResult {
+	period := int64(limit.Period)
+	window := now.UnixNano() / period
+	elapsed := time.Duration(now.UnixNano() - window*period)
+
+	switch k.window {
+	case window:
+	case window - 1:
+		k.prev, k.curr = k.curr, 0
+	default:
+		k.prev, k.curr = 0, 0
+	}
+	k.window = window
+
+	estimate := float64(k.prev)*(1-float64(elapsed)/float64(period)) + float64(k.curr)
+	allowed := estimate+1 <= float64(limit.Requests)
+	if allowed {
+		k.curr++
+	}
+	k.expiresAt = time.Unix(0, (window+2)*period)
+
+	return SlidingWindowResult(limit, allowed, k.prev, k.curr, elapsed)
+}
+
+func (k *memoryKey) tokenBucket(limit interfaces.RateLimit, now time.Time) interfaces.RateLimitResult {
+	tat := k.tat
+	if tat.Before(now) {
+		tat = now
+	}
+
+	next := tat.Add(EmissionInterval(limit))
+	allowed := !now.Before(next.Add(-limit.Period))
+	if allowed {
+		k.tat = next
+		tat = next
+	}
+	k.expiresAt = k.tat
+
+	return TokenBucketResult(limit, allowed, tat.Sub(now))
+}
@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+)
+
+func TestNewMemory_UnknownAlgorithm(t *testing.T) {
+	if _, err := NewMemory("fixed_window"); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("Expected ErrUnknownAlgorithm, got %v", err)
+	}
+	limiter, err := NewMemory("")
+	if err != nil || limiter.algorithm != AlgorithmSlidingWindow {
+		t.Errorf("Expected sliding window by default, got %v (%v)", limiter, err)
+	}
+}
+
+// clock is a settable time source for Memory.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestMemory(t *testing.T, algorithm string) (*Memory, *clock) {
+	t.Helper()
+	limiter, err := NewMemory(algorithm)
+	if err != nil {
+		t.Fatalf("NewMemory failed: %v", err)
+	}
+	// Start on a window boundary so the fixed windows are predictable
+	c := &clock{now: time.Unix(1_700_000_040, 0)}
+	limiter.now = c.Now
+	return limiter, c
+}
+
+// allow counts n requests and returns the last result.
+func allow(t *testing.T, limiter *Memory, n int) interfaces.RateLimitResult {
+	t.Helper()
+	var result interfaces.RateLimitResult
+	for i := 0; i < n; i++ {
+		var err error
+		result, err = limiter.Allow(context.Background(), "key", perMinute)
+		if err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+	}
+	return result
+}
+
+var perMinute = interfaces.RateLimit{Requests: 10, Period: time.Minute}
+
+func TestMemory_SlidingWindow_NoBurstAcrossBoundary(t *testing.T) {
+	limiter, c := newTestMemory(t, AlgorithmSlidingWindow)
+
+	// A full window's worth right before the boundary...
+	c.now = c.now.Add(59 * time.Second)
+	if result := allow(t, limiter, 10); !result.Allowed {
+		t.Fatalf("Expected 10 requests to be allowed, got %+v", result)
+	}
+
+	// ...still counts right after it, where a fixed window would reset
+	c.now = c.now.Add(2 * time.Second)
+	result := allow(t, limiter, 1)
+	if result.Allowed {
+		t.Fatalf("Expected request after the boundary to be rejected")
+	}
+	// 10 * (1 - (1s + wait)/60s) <= 9 once 5s into the window
+	if result.RetryAfter != 5*time.Second {
+		t.Errorf("Expected retry after 5s, got %v", result.RetryAfter)
+	}
+
+	c.now = c.now.Add(result.RetryAfter)
+	if result := allow(t, limiter, 1); !result.Allowed {
+		t.Errorf("Expected request to be allowed after waiting, got %+v", result)
+	}
+}
+
+func TestMemory_SlidingLog(t *testing.T) {
+	limiter, c := newTestMemory(t, AlgorithmSlidingLog)
+
+	allow(t, limiter, 5)
+	c.now = c.now.Add(30 * time.Second)
+	allow(t, limiter, 5)
+
+	result := allow(t, limiter, 1)
+	if result.Allowed || result.RetryAfter != 30*time.Second || result.Reset != time.Minute {
+		t.Fatalf("Expected rejection until the first 5 age out, got %+v", result)
+	}
+
+	// Exactly one period after the first requests they no longer count
+	c.now = c.now.Add(30 * time.Second)
+	result = allow(t, limiter, 1)
+	if !result.Allowed || result.Remaining != 4 {
+		t.Errorf("Expected room for 5 more, got %+v", result)
+	}
+}
+
+func TestMemory_TokenBucket(t *testing.T) {
+	limiter, c := newTestMemory(t, AlgorithmTokenBucket)
+
+	// The full bucket allows a burst of the whole limit...
+	if result := allow(t, limiter, 10); !result.Allowed || result.Remaining != 0 || result.Reset != time.Minute {
+		t.Fatalf("Expected a burst of 10, got %+v", result)
+	}
+
+	// ...then refills one token every period/limit
+	result := allow(t, limiter, 1)
+	if result.Allowed || result.RetryAfter != 6*time.Second {
+		t.Fatalf("Expected retry after one emission interval, got %+v", result)
+	}
+	c.now = c.now.Add(6 * time.Second)
+	if result := allow(t, limiter, 1); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected one refilled token, got %+v", result)
+	}
+
+	c.now = c.now.Add(time.Minute)
+	if result := allow(t, limiter, 1); !result.Allowed || result.Remaining != 9 {
+		t.Errorf("Expected a full bucket after a period, got %+v", result)
+	}
+}
@@ -0,0 +1,142 @@
+// Package ratelimit implements the rate limiting algorithms behind
+// interfaces.RateLimiter. The in-process limiters here serve single
+// instances; repository.NewRedisRateLimiter runs the same algorithms as
+// atomic Redis scripts so limits are shared between instances.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+)
+
+const (
+	// AlgorithmSlidingLog records every request and counts those within
+	// the last period. Exact, but stores one entry per request.
+	AlgorithmSlidingLog = "sliding_log"
+	// AlgorithmSlidingWindow weights the previous fixed window's count by
+	// how much of it still overlaps the sliding window. Two counters per
+	// key, and close to exact for evenly spread traffic.
+	AlgorithmSlidingWindow = "sliding_window"
+	// AlgorithmTokenBucket is the generic cell rate algorithm (GCRA): a
+	// token bucket of Requests tokens refilled evenly over Period, stored
+	// as a single timestamp per key.
+	AlgorithmTokenBucket = "token_bucket"
+)
+
+// ErrUnknownAlgorithm is returned for an unsupported algorithm name.
+var ErrUnknownAlgorithm = errors.New("unknown rate limit algorithm")
+
+// Normalize returns the canonical name of algorithm, defaulting to the
+// sliding window.
+func Normalize(algorithm string) (string, error) {
+	switch a := strings.ToLower(algorithm); a {
+	case "":
+		return AlgorithmSlidingWindow, nil
+	case AlgorithmSlidingLog, AlgorithmSlidingWindow, AlgorithmTokenBucket:
+		return a, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algorithm)
+	}
+}
+
+// SlidingLogResult builds the result of a sliding log that holds count
+// requests within the period (including this one, if allowed), the oldest
+// and newest of which were made oldestAge and newestAge ago.
+func SlidingLogResult(limit interfaces.RateLimit, allowed bool, count int, oldestAge, newestAge time.Duration) interfaces.RateLimitResult {
+	result := interfaces.RateLimitResult{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: max(limit.Requests-count, 0),
+	}
+	if count > 0 {
+		result.Reset = limit.Period - newestAge
+	}
+	if !allowed {
+		result.RetryAfter = limit.Period - oldestAge
+	}
+	return result
+}
+
+// SlidingWindowResult builds the result of a sliding window with prev
+// requests in the previous fixed window and curr (including this one, if
+// allowed) in the current one, elapsed into the current window.
+func SlidingWindowResult(limit interfaces.RateLimit, allowed bool, prev, curr int, elapsed time.Duration) interfaces.RateLimitResult {
+	weight := 1 - float64(elapsed)/float64(limit.Period)
+	estimate := float64(prev)*weight + float64(curr)
+
+	result := interfaces.RateLimitResult{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: max(int(math.Floor(float64(limit.Requests)-estimate)), 0),
+	}
+	switch {
+	case curr > 0:
+		result.Reset = 2*limit.Period - elapsed
+	case prev > 0:
+		result.Reset = limit.Period - elapsed
+	}
+	if !allowed {
+		result.RetryAfter = slidingWindowRetry(prev, curr, limit, elapsed)
+	}
+	return result
+}
+
+// slidingWindowRetry returns how long until the window allows another
+// request.
+func slidingWindowRetry(prev, curr int, limit interfaces.RateLimit, elapsed time.Duration) time.Duration {
+	p := float64(limit.Period)
+	if curr < limit.Requests {
+		if prev == 0 {
+			return 0
+		}
+		// prev * (1 - (elapsed+wait)/period) + curr <= limit - 1
+		wait := p*(1-float64(limit.Requests-1-curr)/float64(prev)) - float64(elapsed)
+		return ceilMillisecond(time.Duration(math.Max(wait, 0)))
+	}
+	// Wait for the next window, where the current count becomes the
+	// previous one: curr * (1 - into/period) <= limit - 1
+	into := p * (1 - float64(limit.Requests-1)/float64(curr))
+	return ceilMillisecond(limit.Period - elapsed + time.Duration(into))
+}
+
+// TokenBucketResult builds the result of GCRA given how far the theoretical
+// arrival time lies ahead of now after the request (unchanged if it was
+// rejected).
+func TokenBucketResult(limit interfaces.RateLimit, allowed bool, tatAhead time.Duration) interfaces.RateLimitResult {
+	interval := EmissionInterval(limit)
+	result := interfaces.RateLimitResult{
+		Allowed: allowed,
+		Limit:   limit.Requests,
+		Reset:   max(tatAhead, 0),
+	}
+	if allowed {
+		result.Remaining = int((limit.Period - tatAhead) / interval)
+	} else {
+		result.RetryAfter = max(tatAhead+interval-limit.Period, 0)
+	}
+	return result
+}
+
+// EmissionInterval is how often GCRA refills one token.
+func EmissionInterval(limit interfaces.RateLimit) time.Duration {
+	return limit.Period / time.Duration(limit.Requests)
+}
+
+// ceilMillisecond rounds d up to a whole millisecond, the resolution the
+// Redis scripts work at.
+func ceilMillisecond(d time.Duration) time.Duration {
+	if r := d % time.Millisecond; r != 0 {
+		d += time.Millisecond - r
+	}
+	return d
+}
+
+// Disabled reports whether limit allows any number of requests.
+func Disabled(limit interfaces.RateLimit) bool {
+	return limit.Requests <= 0 || limit.Period <= 0
+}
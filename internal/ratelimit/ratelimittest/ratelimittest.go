@@ -0,0 +1,161 @@
+// Package ratelimittest is a conformance suite for interfaces.RateLimiter
+// implementations, run once per ratelimit algorithm:
+//
+//	func TestMyLimiter_Conformance(t *testing.T) {
+//		ratelimittest.TestRateLimiter(t, func(t *testing.T, algorithm string) interfaces.RateLimiter {
+//			return newMyLimiter(t, algorithm)
+//		})
+//	}
+//
+// The suite uses fresh random keys and limits long enough not to refill
+// while it runs, so it can run against a shared server.
+package ratelimittest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/ratelimit"
+)
+
+// Factory returns the limiter under test using algorithm.
+type Factory func(t *testing.T, algorithm string) interfaces.RateLimiter
+
+// testLimit is small enough to exhaust quickly and slow enough not to refill
+// during a test.
+var testLimit = interfaces.RateLimit{Requests: 5, Period: time.Hour}
+
+// TestRateLimiter runs the conformance suite for every algorithm against the
+// limiters returned by newLimiter.
+func TestRateLimiter(t *testing.T, newLimiter Factory) {
+	algorithms := []string{
+		ratelimit.AlgorithmSlidingLog,
+		ratelimit.AlgorithmSlidingWindow,
+		ratelimit.AlgorithmTokenBucket,
+	}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, limiter interfaces.RateLimiter)
+	}{
+		{"AllowsUpToLimit", testAllowsUpToLimit},
+		{"KeysAreIndependent", testKeysAreIndependent},
+		{"ZeroLimitAllowsAll", testZeroLimitAllowsAll},
+		{"Concurrent", testConcurrent},
+	}
+
+	for _, algorithm := range algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					tt.fn(t, newLimiter(t, algorithm))
+				})
+			}
+		})
+	}
+}
+
+func testAllowsUpToLimit(t *testing.T, limiter interfaces.RateLimiter) {
+	ctx := context.Background()
+	key := randomKey(t)
+
+	for i := 0; i < testLimit.Requests; i++ {
+		result, err := limiter.Allow(ctx, key, testLimit)
+		if err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+		if !result.Allowed || result.Limit != testLimit.Requests || result.RetryAfter != 0 {
+			t.Fatalf("Expected request %d to be allowed, got %+v", i+1, result)
+		}
+		if want := testLimit.Requests - i - 1; result.Remaining != want {
+			t.Errorf("Expected %d remaining after request %d, got %d", want, i+1, result.Remaining)
+		}
+		// The sliding window estimate only drops to zero at the end of the
+		// window after the current one
+		if result.Reset <= 0 || result.Reset > 2*testLimit.Period {
+			t.Errorf("Expected reset within two periods, got %v", result.Reset)
+		}
+	}
+
+	result, err := limiter.Allow(ctx, key, testLimit)
+	if err != nil {
+		t.Fatalf("Allow failed: %v", err)
+	}
+	if result.Allowed || result.Remaining != 0 {
+		t.Fatalf("Expected request over the limit to be rejected, got %+v", result)
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > result.Reset {
+		t.Errorf("Expected retry after within the reset time, got %v (reset %v)", result.RetryAfter, result.Reset)
+	}
+}
+
+func testKeysAreIndependent(t *testing.T, limiter interfaces.RateLimiter) {
+	ctx := context.Background()
+	first, second := randomKey(t), randomKey(t)
+
+	for i := 0; i < testLimit.Requests; i++ {
+		if _, err := limiter.Allow(ctx, first, testLimit); err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+	}
+	result, err := limiter.Allow(ctx, second, testLimit)
+	if err != nil {
+		t.Fatalf("Allow failed: %v", err)
+	}
+	if !result.Allowed || result.Remaining != testLimit.Requests-1 {
+		t.Errorf("Expected a fresh key to be unaffected, got %+v", result)
+	}
+}
+
+func testZeroLimitAllowsAll(t *testing.T, limiter interfaces.RateLimiter) {
+	key := randomKey(t)
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow(context.Background(), key, interfaces.RateLimit{})
+		if err != nil || !result.Allowed {
+			t.Fatalf("Expected zero limit to allow requests, got %+v (%v)", result, err)
+		}
+	}
+}
+
+func testConcurrent(t *testing.T, limiter interfaces.RateLimiter) {
+	const callers = 20
+	key := randomKey(t)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	allowed := 0
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := limiter.Allow(context.Background(), key, testLimit)
+			if err != nil {
+				t.Errorf("Allow failed: %v", err)
+				return
+			}
+			if result.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != testLimit.Requests {
+		t.Errorf("Expected exactly %d of %d concurrent requests allowed, got %d", testLimit.Requests, callers, allowed)
+	}
+}
+
+func randomKey(t *testing.T) string {
+	t.Helper()
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return "ratelimittest:" + hex.EncodeToString(b)
+}
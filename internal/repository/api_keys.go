@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+type APIKeyRepository struct {
+	db *PostgresDB
+}
+
+func NewAPIKeyRepository(db *PostgresDB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// CreateAPIKey looks plans up in the plans table.
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, k *models.APIKey) (*models.APIKey, error) {
+	ctx, cancel := r.db.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		WITH created AS (
+			INSERT INTO api_keys (owner_id, name, key_hash, plan, created_at)
+			VALUES ($1, $2, $3, $4, NOW())
+			RETURNING id, owner_id, name, key_hash, plan, created_at, revoked_at
+		)
+		SELECT created.*, p.requests_per_minute, p.links_per_day, p.links_per_month
+		FROM created JOIN plans p ON p.name = created.plan`
+
+	key, err := scanAPIKey(r.db.db.QueryRowContext(ctx, query, k.OwnerID, k.Name, k.KeyHash, planOrDefault(k.Plan)))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("%w: API key already exists", interfaces.ErrConflict)
+		}
+		if isForeignKeyViolation(err) {
+			return nil, fmt.Errorf("%w: %s", interfaces.ErrUnknownPlan, planOrDefault(k.Plan))
+		}
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (r *APIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	ctx, cancel := r.db.readContext(ctx)
+	defer cancel()
+
+	query := `
+		SELECT k.id, k.owner_id, k.name, k.key_hash, k.plan, k.created_at, k.revoked_at,
+			p.requests_per_minute, p.links_per_day, p.links_per_month
+		FROM api_keys k JOIN plans p ON p.name = k.plan
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL`
+
+	key, err := scanAPIKey(r.db.db.QueryRowContext(ctx, query, keyHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, interfaces.ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return key, nil
+}
+
+func scanAPIKey(row *sql.Row) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	err := row.Scan(
+		&key.ID,
+		&key.OwnerID,
+		&key.Name,
+		&key.KeyHash,
+		&key.Plan,
+		&key.CreatedAt,
+		&key.RevokedAt,
+		&key.Quota.RequestsPerMinute,
+		&key.Quota.LinksPerDay,
+		&key.Quota.LinksPerMonth,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,470 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltURLSchemes are the DATABASE_URL schemes served by the embedded store.
+var boltURLSchemes = []string{"file://", "bolt://"}
+
+// boltOpenTimeout bounds how long opening waits for another process to
+// release the file lock.
+const boltOpenTimeout = 5 * time.Second
+
+// Buckets of the embedded store. Index keys join fields with keySep and end
+// in a big-endian link ID, so prefix scans return links in creation order.
+var (
+	bucketURLs            = []byte("urls")                // domain/code -> boltURL
+	bucketURLCodes        = []byte("url_codes")           // code/domain -> nil
+	bucketURLOwners       = []byte("urls_by_owner")       // owner/id -> urls key
+	bucketURLDestinations = []byte("urls_by_destination") // owner/domain/hash/id -> urls key
+	bucketClicks          = []byte("clicks")              // domain/code/seq -> boltClick
+	bucketAPIKeys         = []byte("api_keys")            // key hash -> models.APIKey
+	bucketAPIKeyUsage     = []byte("api_key_usage")       // id/day -> links created
+	bucketCodePool        = []byte("short_code_pool")     // code -> nil
+	bucketSequence        = []byte("short_code_seq")      // sequence only
+)
+
+const keySep = "\x00"
+
+// BoltPath returns the file path of an embedded store DATABASE_URL such as
+// file:///var/lib/shortener/links.db, and false for any other URL.
+func BoltPath(databaseURL string) (string, bool) {
+	for _, scheme := range boltURLSchemes {
+		if strings.HasPrefix(databaseURL, scheme) {
+			return strings.TrimPrefix(databaseURL, scheme), true
+		}
+	}
+	return "", false
+}
+
+// BoltDB is an embedded single-file store backing the Bolt* repositories,
+// for deployments without Postgres. Only one process may open the file at a
+// time.
+type BoltDB struct {
+	db *bolt.DB
+}
+
+// NewBoltDB opens or creates the store at path.
+func NewBoltDB(path string) (*BoltDB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{
+			bucketURLs, bucketURLCodes, bucketURLOwners, bucketURLDestinations,
+			bucketClicks, bucketAPIKeys, bucketAPIKeyUsage, bucketCodePool, bucketSequence,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create buckets: %w", err)
+	}
+
+	return &BoltDB{db: db}, nil
+}
+
+func (b *BoltDB) Close() error {
+	return b.db.Close()
+}
+
+// view and update run fn in a read-only or read-write transaction once ctx
+// is checked. Transactions are local and short, so ctx is not consulted
+// again while fn runs.
+func (b *BoltDB) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.View(fn)
+}
+
+func (b *BoltDB) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.Update(fn)
+}
+
+// boltKey joins key fields with keySep.
+func boltKey(fields ...string) []byte {
+	return []byte(strings.Join(fields, keySep))
+}
+
+// boltPrefix is boltKey with a trailing separator, for prefix scans.
+func boltPrefix(fields ...string) []byte {
+	return append(boltKey(fields...), keySep...)
+}
+
+func boltID(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
+
+// boltURL is the stored form of a link. models.URL hides DestinationHash
+// from JSON, so it cannot be stored directly.
+type boltURL struct {
+	ID              int        `json:"id"`
+	OriginalURL     string     `json:"original_url"`
+	NormalizedURL   string     `json:"normalized_url,omitempty"`
+	ShortCode       string     `json:"short_code"`
+	Domain          string     `json:"domain"`
+	OwnerID         string     `json:"owner_id,omitempty"`
+	DestinationHash string     `json:"destination_hash,omitempty"`
+	RedirectType    int        `json:"redirect_type"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func (u *boltURL) model() *models.URL {
+	return &models.URL{
+		ID:              u.ID,
+		OriginalURL:     u.OriginalURL,
+		NormalizedURL:   u.NormalizedURL,
+		ShortCode:       u.ShortCode,
+		Domain:          u.Domain,
+		OwnerID:         u.OwnerID,
+		DestinationHash: u.DestinationHash,
+		RedirectType:    u.RedirectType,
+		ExpiresAt:       u.ExpiresAt,
+		CreatedAt:       u.CreatedAt,
+		UpdatedAt:       u.UpdatedAt,
+	}
+}
+
+func (u *boltURL) key() []byte {
+	return boltKey(u.Domain, u.ShortCode)
+}
+
+// ownerKey and destinationKey index the link; both are nil for links
+// without an owner, and destinationKey also for links without a hash.
+func (u *boltURL) ownerKey() []byte {
+	if u.OwnerID == "" {
+		return nil
+	}
+	return append(boltPrefix(u.OwnerID), boltID(uint64(u.ID))...)
+}
+
+func (u *boltURL) destinationKey() []byte {
+	if u.OwnerID == "" || u.DestinationHash == "" {
+		return nil
+	}
+	return append(boltPrefix(u.OwnerID, u.Domain, u.DestinationHash), boltID(uint64(u.ID))...)
+}
+
+func getBoltURL(tx *bolt.Tx, key []byte) (*boltURL, error) {
+	v := tx.Bucket(bucketURLs).Get(key)
+	if v == nil {
+		return nil, interfaces.ErrNotFound
+	}
+	var u boltURL
+	if err := json.Unmarshal(v, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// putBoltURL writes the link and its index entries.
+func putBoltURL(tx *bolt.Tx, u *boltURL) error {
+	v, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketURLs).Put(u.key(), v); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketURLCodes).Put(boltKey(u.ShortCode, u.Domain), nil); err != nil {
+		return err
+	}
+	if k := u.ownerKey(); k != nil {
+		if err := tx.Bucket(bucketURLOwners).Put(k, u.key()); err != nil {
+			return err
+		}
+	}
+	if k := u.destinationKey(); k != nil {
+		if err := tx.Bucket(bucketURLDestinations).Put(k, u.key()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteBoltURL removes the link and its index entries.
+func deleteBoltURL(tx *bolt.Tx, u *boltURL) error {
+	if err := tx.Bucket(bucketURLs).Delete(u.key()); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketURLCodes).Delete(boltKey(u.ShortCode, u.Domain)); err != nil {
+		return err
+	}
+	if k := u.ownerKey(); k != nil {
+		if err := tx.Bucket(bucketURLOwners).Delete(k); err != nil {
+			return err
+		}
+	}
+	if k := u.destinationKey(); k != nil {
+		if err := tx.Bucket(bucketURLDestinations).Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BoltURLRepository is a URLRepository backed by a BoltDB.
+type BoltURLRepository struct {
+	db *BoltDB
+}
+
+func NewBoltURLRepository(db *BoltDB) *BoltURLRepository {
+	return &BoltURLRepository{db: db}
+}
+
+// insertBoltURL stores a new link and reports false if its short code is taken.
+func insertBoltURL(tx *bolt.Tx, u *models.URL, now time.Time) (*models.URL, bool, error) {
+	urls := tx.Bucket(bucketURLs)
+	if urls.Get(boltKey(u.Domain, u.ShortCode)) != nil {
+		return nil, false, nil
+	}
+
+	id, err := urls.NextSequence()
+	if err != nil {
+		return nil, false, err
+	}
+	stored := &boltURL{
+		ID:              int(id),
+		OriginalURL:     u.OriginalURL,
+		NormalizedURL:   u.NormalizedURL,
+		ShortCode:       u.ShortCode,
+		Domain:          u.Domain,
+		OwnerID:         u.OwnerID,
+		DestinationHash: u.DestinationHash,
+		RedirectType:    u.RedirectType,
+		ExpiresAt:       u.ExpiresAt,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := putBoltURL(tx, stored); err != nil {
+		return nil, false, err
+	}
+	return stored.model(), true, nil
+}
+
+func (r *BoltURLRepository) CreateURL(ctx context.Context, u *models.URL) (*models.URL, error) {
+	var url *models.URL
+	var inserted bool
+	err := r.db.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		url, inserted, err = insertBoltURL(tx, u, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create URL: %w", err)
+	}
+	if !inserted {
+		return nil, fmt.Errorf("%w: short code %q is taken", interfaces.ErrConflict, u.ShortCode)
+	}
+
+	return url, nil
+}
+
+// CreateURLs inserts the links in one transaction.
+func (r *BoltURLRepository) CreateURLs(ctx context.Context, urls []*models.URL) ([]*models.URL, error) {
+	var created []*models.URL
+	err := r.db.update(ctx, func(tx *bolt.Tx) error {
+		created = make([]*models.URL, 0, len(urls))
+		now := time.Now()
+		for _, u := range urls {
+			url, inserted, err := insertBoltURL(tx, u, now)
+			if err != nil {
+				return err
+			}
+			if inserted {
+				created = append(created, url)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create URLs: %w", err)
+	}
+
+	return created, nil
+}
+
+func (r *BoltURLRepository) GetURLByShortCode(ctx context.Context, domain, shortCode string) (*models.URL, error) {
+	var url *boltURL
+	err := r.db.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		url, err = getBoltURL(tx, boltKey(domain, shortCode))
+		return err
+	})
+	if errors.Is(err, interfaces.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get URL: %w", err)
+	}
+
+	return url.model(), nil
+}
+
+func (r *BoltURLRepository) UpdateURL(ctx context.Context, u *models.URL) (*models.URL, error) {
+	var url *boltURL
+	err := r.db.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		url, err = getBoltURL(tx, boltKey(u.Domain, u.ShortCode))
+		if err != nil {
+			return err
+		}
+		// Drop the old destination index entry before the hash changes
+		if err := deleteBoltURL(tx, url); err != nil {
+			return err
+		}
+
+		url.OriginalURL = u.OriginalURL
+		url.NormalizedURL = u.NormalizedURL
+		url.DestinationHash = u.DestinationHash
+		url.RedirectType = u.RedirectType
+		url.UpdatedAt = time.Now()
+		return putBoltURL(tx, url)
+	})
+	if errors.Is(err, interfaces.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update URL: %w", err)
+	}
+
+	return url.model(), nil
+}
+
+func (r *BoltURLRepository) DeleteURL(ctx context.Context, domain, shortCode string) error {
+	err := r.db.update(ctx, func(tx *bolt.Tx) error {
+		url, err := getBoltURL(tx, boltKey(domain, shortCode))
+		if err != nil {
+			return err
+		}
+		if err := deleteBoltURL(tx, url); err != nil {
+			return err
+		}
+		return deleteBoltClicks(tx, domain, shortCode)
+	})
+	if errors.Is(err, interfaces.ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete URL: %w", err)
+	}
+
+	return nil
+}
+
+func (r *BoltURLRepository) FindURLByDestination(ctx context.Context, ownerID, domain, destinationHash string) (*models.URL, error) {
+	// Links without an owner or hash are not indexed, as with NULL in Postgres
+	if ownerID == "" || destinationHash == "" {
+		return nil, interfaces.ErrNotFound
+	}
+
+	var found *boltURL
+	err := r.db.view(ctx, func(tx *bolt.Tx) error {
+		now := time.Now()
+		prefix := boltPrefix(ownerID, domain, destinationHash)
+		c := tx.Bucket(bucketURLDestinations).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			url, err := getBoltURL(tx, v)
+			if err != nil {
+				return err
+			}
+			if !url.model().IsExpired(now) {
+				found = url
+				return nil
+			}
+		}
+		return interfaces.ErrNotFound
+	})
+	if errors.Is(err, interfaces.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find URL by destination: %w", err)
+	}
+
+	return found.model(), nil
+}
+
+func (r *BoltURLRepository) ListURLsByOwner(ctx context.Context, ownerID string, limit, offset int) ([]*models.URL, int, error) {
+	urls := []*models.URL{}
+	var total int
+	err := r.db.view(ctx, func(tx *bolt.Tx) error {
+		if ownerID == "" {
+			return nil
+		}
+
+		// The index is in creation order; collect it and page from the end
+		var keys [][]byte
+		prefix := boltPrefix(ownerID)
+		c := tx.Bucket(bucketURLOwners).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			keys = append(keys, v)
+		}
+		total = len(keys)
+
+		for i := total - 1 - offset; i >= 0 && len(urls) < limit; i-- {
+			url, err := getBoltURL(tx, keys[i])
+			if err != nil {
+				return err
+			}
+			urls = append(urls, url.model())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list URLs: %w", err)
+	}
+
+	return urls, total, nil
+}
+
+// BoltSequenceCounter hands out consecutive values starting at 0, like the
+// short_code_seq sequence. Values survive restarts.
+type BoltSequenceCounter struct {
+	db *BoltDB
+}
+
+func NewBoltSequenceCounter(db *BoltDB) *BoltSequenceCounter {
+	return &BoltSequenceCounter{db: db}
+}
+
+func (c *BoltSequenceCounter) Next(ctx context.Context) (uint64, error) {
+	var n uint64
+	err := c.db.update(ctx, func(tx *bolt.Tx) error {
+		seq, err := tx.Bucket(bucketSequence).NextSequence()
+		// Bolt sequences start at 1
+		n = seq - 1
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve sequence values: %w", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltAPIKeyRepository is an APIKeyRepository backed by a BoltDB. Keys are
+// stored under their hash, and their plans resolved from DefaultPlans.
+type BoltAPIKeyRepository struct {
+	db *BoltDB
+}
+
+func NewBoltAPIKeyRepository(db *BoltDB) *BoltAPIKeyRepository {
+	return &BoltAPIKeyRepository{db: db}
+}
+
+func (r *BoltAPIKeyRepository) CreateAPIKey(ctx context.Context, k *models.APIKey) (*models.APIKey, error) {
+	plan := planOrDefault(k.Plan)
+	quota, ok := DefaultPlans[plan]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", interfaces.ErrUnknownPlan, plan)
+	}
+
+	key := &models.APIKey{
+		OwnerID:   k.OwnerID,
+		Name:      k.Name,
+		KeyHash:   k.KeyHash,
+		CreatedAt: time.Now(),
+		Plan:      plan,
+	}
+	err := r.db.update(ctx, func(tx *bolt.Tx) error {
+		keys := tx.Bucket(bucketAPIKeys)
+		if keys.Get([]byte(k.KeyHash)) != nil {
+			return fmt.Errorf("%w: API key already exists", interfaces.ErrConflict)
+		}
+
+		id, err := keys.NextSequence()
+		if err != nil {
+			return err
+		}
+		key.ID = int(id)
+
+		v, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		return keys.Put([]byte(k.KeyHash), v)
+	})
+	key.Quota = quota
+	if errors.Is(err, interfaces.ErrConflict) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (r *BoltAPIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	var key *models.APIKey
+	err := r.db.view(ctx, func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketAPIKeys).Get([]byte(keyHash))
+		if v == nil {
+			return nil
+		}
+		key = &models.APIKey{}
+		return json.Unmarshal(v, key)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	if key == nil || key.RevokedAt != nil {
+		return nil, interfaces.ErrInvalidAPIKey
+	}
+
+	// KeyHash is not serialized, and keys stored before plans existed stay
+	// unlimited as they do in Postgres
+	key.KeyHash = keyHash
+	if key.Plan == "" {
+		key.Plan = "unlimited"
+	}
+	key.Quota = DefaultPlans[key.Plan]
+	return key, nil
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltClick is the stored form of a click; the link is part of the key.
+type boltClick struct {
+	ClickedAt time.Time `json:"t"`
+	Referrer  string    `json:"r,omitempty"`
+	UserAgent string    `json:"ua,omitempty"`
+	IPAddress string    `json:"ip,omitempty"`
+}
+
+// BoltClickRepository is a ClickRepository backed by a BoltDB.
+type BoltClickRepository struct {
+	db *BoltDB
+}
+
+func NewBoltClickRepository(db *BoltDB) *BoltClickRepository {
+	return &BoltClickRepository{db: db}
+}
+
+// InsertClicks writes the batch in one transaction.
+func (r *BoltClickRepository) InsertClicks(ctx context.Context, events []models.ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	err := r.db.update(ctx, func(tx *bolt.Tx) error {
+		clicks := tx.Bucket(bucketClicks)
+		for _, e := range events {
+			seq, err := clicks.NextSequence()
+			if err != nil {
+				return err
+			}
+			v, err := json.Marshal(boltClick{
+				ClickedAt: e.ClickedAt,
+				Referrer:  e.Referrer,
+				UserAgent: e.UserAgent,
+				IPAddress: e.IPAddress,
+			})
+			if err != nil {
+				return err
+			}
+			if err := clicks.Put(append(boltPrefix(e.Domain, e.ShortCode), boltID(seq)...), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert clicks: %w", err)
+	}
+
+	return nil
+}
+
+func (r *BoltClickRepository) GetLinkStats(ctx context.Context, domain, shortCode string, days, topReferrers int) (*models.LinkStats, error) {
+	stats := newLinkStatsBuilder(domain, shortCode, days)
+	err := r.db.view(ctx, func(tx *bolt.Tx) error {
+		prefix := boltPrefix(domain, shortCode)
+		c := tx.Bucket(bucketClicks).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var click boltClick
+			if err := json.Unmarshal(v, &click); err != nil {
+				return err
+			}
+			stats.add(click.ClickedAt, click.Referrer)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link stats: %w", err)
+	}
+
+	return stats.build(topReferrers), nil
+}
+
+// deleteBoltClicks removes every click recorded for a link.
+func deleteBoltClicks(tx *bolt.Tx, domain, shortCode string) error {
+	prefix := boltPrefix(domain, shortCode)
+	c := tx.Bucket(bucketClicks).Cursor()
+	var keys [][]byte
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, k)
+	}
+	// Deleting while iterating can skip keys, so delete afterwards
+	for _, k := range keys {
+		if err := c.Bucket().Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltKeyPoolRepository is a KeyPoolRepository backed by a BoltDB.
+type BoltKeyPoolRepository struct {
+	db *BoltDB
+}
+
+func NewBoltKeyPoolRepository(db *BoltDB) *BoltKeyPoolRepository {
+	return &BoltKeyPoolRepository{db: db}
+}
+
+func (r *BoltKeyPoolRepository) AddCodes(ctx context.Context, codes []string) (int, error) {
+	added := 0
+	err := r.db.update(ctx, func(tx *bolt.Tx) error {
+		pool := tx.Bucket(bucketCodePool)
+		used := tx.Bucket(bucketURLCodes).Cursor()
+		for _, code := range codes {
+			if pool.Get([]byte(code)) != nil {
+				continue
+			}
+			prefix := boltPrefix(code)
+			if k, _ := used.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix) {
+				continue
+			}
+			if err := pool.Put([]byte(code), []byte{}); err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to add pooled codes: %w", err)
+	}
+
+	return added, nil
+}
+
+func (r *BoltKeyPoolRepository) LeaseCodes(ctx context.Context, n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	err := r.db.update(ctx, func(tx *bolt.Tx) error {
+		pool := tx.Bucket(bucketCodePool)
+		c := pool.Cursor()
+		for k, _ := c.First(); k != nil && len(codes) < n; k, _ = c.Next() {
+			codes = append(codes, string(k))
+		}
+		// Deleting while iterating can skip keys, so delete afterwards
+		for _, code := range codes {
+			if err := pool.Delete([]byte(code)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+func (r *BoltKeyPoolRepository) AvailableCodes(ctx context.Context) (int, error) {
+	var available int
+	err := r.db.view(ctx, func(tx *bolt.Tx) error {
+		available = tx.Bucket(bucketCodePool).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pooled codes: %w", err)
+	}
+
+	return available, nil
+}
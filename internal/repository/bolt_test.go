@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+func openTestBoltDB(t *testing.T, path string) *BoltDB {
+	t.Helper()
+	db, err := NewBoltDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	return db
+}
+
+func TestBoltPath(t *testing.T) {
+	tests := []struct {
+		url  string
+		path string
+		ok   bool
+	}{
+		{"file:///var/lib/links.db", "/var/lib/links.db", true},
+		{"file://data/links.db", "data/links.db", true},
+		{"bolt:///tmp/links.db", "/tmp/links.db", true},
+		{"postgres://localhost:5432/urlshortener", "", false},
+	}
+
+	for _, tt := range tests {
+		path, ok := BoltPath(tt.url)
+		if path != tt.path || ok != tt.ok {
+			t.Errorf("BoltPath(%q) = %q, %v; want %q, %v", tt.url, path, ok, tt.path, tt.ok)
+		}
+	}
+}
+
+func TestBoltDB_PersistsAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "links.db")
+
+	db := openTestBoltDB(t, path)
+	first, err := NewBoltURLRepository(db).CreateURL(ctx, &models.URL{
+		OriginalURL: "https://example.com", ShortCode: "abc", OwnerID: "owner-1", RedirectType: 302,
+	})
+	if err != nil {
+		t.Fatalf("CreateURL failed: %v", err)
+	}
+	if n, _ := NewBoltSequenceCounter(db).Next(ctx); n != 0 {
+		t.Errorf("Expected first sequence value 0, got %d", n)
+	}
+	db.Close()
+
+	db = openTestBoltDB(t, path)
+	defer db.Close()
+	repo := NewBoltURLRepository(db)
+
+	url, err := repo.GetURLByShortCode(ctx, "", "abc")
+	if err != nil {
+		t.Fatalf("Expected link after reopen, got %v", err)
+	}
+	if url.OriginalURL != "https://example.com" || url.ID != first.ID {
+		t.Errorf("Unexpected link after reopen: %+v", url)
+	}
+
+	second, err := repo.CreateURL(ctx, &models.URL{OriginalURL: "https://example.org", ShortCode: "def", RedirectType: 302})
+	if err != nil {
+		t.Fatalf("CreateURL failed: %v", err)
+	}
+	if second.ID <= first.ID {
+		t.Errorf("Expected IDs to keep increasing, got %d after %d", second.ID, first.ID)
+	}
+	if n, _ := NewBoltSequenceCounter(db).Next(ctx); n != 1 {
+		t.Errorf("Expected sequence to continue at 1, got %d", n)
+	}
+}
+
+func TestBoltURLRepository_UpdateMovesDestinationIndex(t *testing.T) {
+	ctx := context.Background()
+	db := openTestBoltDB(t, filepath.Join(t.TempDir(), "links.db"))
+	defer db.Close()
+	repo := NewBoltURLRepository(db)
+
+	_, err := repo.CreateURL(ctx, &models.URL{
+		OriginalURL: "https://example.com/a", ShortCode: "abc", OwnerID: "owner-1", DestinationHash: "hash-a", RedirectType: 302,
+	})
+	if err != nil {
+		t.Fatalf("CreateURL failed: %v", err)
+	}
+
+	_, err = repo.UpdateURL(ctx, &models.URL{
+		OriginalURL: "https://example.com/b", ShortCode: "abc", DestinationHash: "hash-b", RedirectType: 301,
+	})
+	if err != nil {
+		t.Fatalf("UpdateURL failed: %v", err)
+	}
+
+	if _, err := repo.FindURLByDestination(ctx, "owner-1", "", "hash-a"); !errors.Is(err, interfaces.ErrNotFound) {
+		t.Errorf("Expected old destination to be unindexed, got %v", err)
+	}
+	url, err := repo.FindURLByDestination(ctx, "owner-1", "", "hash-b")
+	if err != nil {
+		t.Fatalf("Expected new destination to be indexed, got %v", err)
+	}
+	if url.OwnerID != "owner-1" || url.RedirectType != 301 {
+		t.Errorf("Update lost or missed fields: %+v", url)
+	}
+
+	if err := repo.DeleteURL(ctx, "", "abc"); err != nil {
+		t.Fatalf("DeleteURL failed: %v", err)
+	}
+	urls, total, err := repo.ListURLsByOwner(ctx, "owner-1", 10, 0)
+	if err != nil || total != 0 || len(urls) != 0 {
+		t.Errorf("Expected no links after delete, got %d (total %d, err %v)", len(urls), total, err)
+	}
+	if _, err := repo.FindURLByDestination(ctx, "owner-1", "", "hash-b"); !errors.Is(err, interfaces.ErrNotFound) {
+		t.Errorf("Expected deleted link to be unindexed, got %v", err)
+	}
+}
+
+func TestBoltKeyPoolRepository_SkipsUsedAndPooledCodes(t *testing.T) {
+	ctx := context.Background()
+	db := openTestBoltDB(t, filepath.Join(t.TempDir(), "links.db"))
+	defer db.Close()
+	pool := NewBoltKeyPoolRepository(db)
+
+	_, err := NewBoltURLRepository(db).CreateURL(ctx, &models.URL{
+		OriginalURL: "https://example.com", ShortCode: "used", Domain: "go.example.com", RedirectType: 302,
+	})
+	if err != nil {
+		t.Fatalf("CreateURL failed: %v", err)
+	}
+
+	added, err := pool.AddCodes(ctx, []string{"aaa", "used", "bbb", "aaa"})
+	if err != nil || added != 2 {
+		t.Fatalf("Expected 2 codes added, got %d (%v)", added, err)
+	}
+	if added, _ := pool.AddCodes(ctx, []string{"bbb"}); added != 0 {
+		t.Errorf("Expected pooled code to be skipped, got %d added", added)
+	}
+
+	codes, err := pool.LeaseCodes(ctx, 5)
+	if err != nil || len(codes) != 2 {
+		t.Fatalf("Expected to lease 2 codes, got %v (%v)", codes, err)
+	}
+	if available, _ := pool.AvailableCodes(ctx); available != 0 {
+		t.Errorf("Expected empty pool after leasing, got %d", available)
+	}
+}
+
+func TestBoltAPIKeyRepository(t *testing.T) {
+	ctx := context.Background()
+	db := openTestBoltDB(t, filepath.Join(t.TempDir(), "links.db"))
+	defer db.Close()
+	keys := NewBoltAPIKeyRepository(db)
+
+	created, err := keys.CreateAPIKey(ctx, &models.APIKey{OwnerID: "owner-1", Name: "ci", KeyHash: "hash"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if _, err := keys.CreateAPIKey(ctx, &models.APIKey{OwnerID: "owner-2", KeyHash: "hash"}); !errors.Is(err, interfaces.ErrConflict) {
+		t.Errorf("Expected ErrConflict for duplicate hash, got %v", err)
+	}
+
+	key, err := keys.GetAPIKeyByHash(ctx, "hash")
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash failed: %v", err)
+	}
+	if key.ID != created.ID || key.OwnerID != "owner-1" || key.KeyHash != "hash" {
+		t.Errorf("Unexpected key: %+v", key)
+	}
+	if _, err := keys.GetAPIKeyByHash(ctx, "other"); !errors.Is(err, interfaces.ErrInvalidAPIKey) {
+		t.Errorf("Expected ErrInvalidAPIKey for unknown hash, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltUsageRepository is a UsageRepository backed by a BoltDB. Counts are
+// stored under the key's big-endian ID followed by the UTC day, so a month
+// is a prefix scan.
+type BoltUsageRepository struct {
+	db *BoltDB
+}
+
+func NewBoltUsageRepository(db *BoltDB) *BoltUsageRepository {
+	return &BoltUsageRepository{db: db}
+}
+
+// ReserveLinks runs in a single write transaction, which bolt serializes.
+func (r *BoltUsageRepository) ReserveLinks(ctx context.Context, key *models.APIKey, n int, now time.Time) error {
+	err := r.db.update(ctx, func(tx *bolt.Tx) error {
+		usage := tx.Bucket(bucketAPIKeyUsage)
+		day, month := boltCountLinks(usage, key.ID, now)
+		if err := checkQuota(key.Quota, day, month, n, now); err != nil {
+			return err
+		}
+		return usage.Put(boltUsageKey(key.ID, usageDay(now)), boltID(uint64(day+n)))
+	})
+	if errors.Is(err, interfaces.ErrQuotaExceeded) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to count links: %w", err)
+	}
+
+	return nil
+}
+
+func (r *BoltUsageRepository) ReleaseLinks(ctx context.Context, keyID, n int, now time.Time) error {
+	err := r.db.update(ctx, func(tx *bolt.Tx) error {
+		usage := tx.Bucket(bucketAPIKeyUsage)
+		k := boltUsageKey(keyID, usageDay(now))
+		v := usage.Get(k)
+		if v == nil {
+			return nil
+		}
+		return usage.Put(k, boltID(uint64(max(int(binary.BigEndian.Uint64(v))-n, 0))))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release links: %w", err)
+	}
+
+	return nil
+}
+
+func (r *BoltUsageRepository) CountLinks(ctx context.Context, keyID int, now time.Time) (int, int, error) {
+	var day, month int
+	err := r.db.view(ctx, func(tx *bolt.Tx) error {
+		day, month = boltCountLinks(tx.Bucket(bucketAPIKeyUsage), keyID, now)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count links: %w", err)
+	}
+
+	return day, month, nil
+}
+
+func boltUsageKey(keyID int, period string) []byte {
+	return append(boltID(uint64(keyID)), period...)
+}
+
+// boltCountLinks sums the key's links on now's day and in now's month.
+func boltCountLinks(usage *bolt.Bucket, keyID int, now time.Time) (day, month int) {
+	today := boltUsageKey(keyID, usageDay(now))
+	prefix := boltUsageKey(keyID, usageMonth(now))
+	c := usage.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		used := int(binary.BigEndian.Uint64(v))
+		month += used
+		if bytes.Equal(k, today) {
+			day = used
+		}
+	}
+	return day, month
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jonmanahan/url-shortener/internal/models"
+	"github.com/lib/pq"
+)
+
+type ClickRepository struct {
+	db *PostgresDB
+}
+
+func NewClickRepository(db *PostgresDB) *ClickRepository {
+	return &ClickRepository{db: db}
+}
+
+// InsertClicks writes the batch with a single COPY.
+func (r *ClickRepository) InsertClicks(ctx context.Context, events []models.ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	ctx, cancel := r.db.batchContext(ctx)
+	defer cancel()
+
+	tx, err := r.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("clicks", "short_code", "domain", "clicked_at", "referrer", "user_agent", "ip_address"))
+	if err != nil {
+		return fmt.Errorf("failed to prepare click copy: %w", err)
+	}
+
+	for _, e := range events {
+		if _, err := stmt.ExecContext(ctx, e.ShortCode, e.Domain, e.ClickedAt, e.Referrer, e.UserAgent, e.IPAddress); err != nil {
+			_ = stmt.Close()
+			return fmt.Errorf("failed to copy click: %w", err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		_ = stmt.Close()
+		return fmt.Errorf("failed to flush click copy: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("failed to close click copy: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit clicks: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ClickRepository) GetLinkStats(ctx context.Context, domain, shortCode string, days, topReferrers int) (*models.LinkStats, error) {
+	ctx, cancel := r.db.batchContext(ctx)
+	defer cancel()
+
+	stats := &models.LinkStats{
+		ShortCode:    shortCode,
+		Domain:       domain,
+		ClicksPerDay: []models.DailyClicks{},
+		TopReferrers: []models.ReferrerCount{},
+	}
+
+	err := r.db.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM clicks WHERE domain = $1 AND short_code = $2`, domain, shortCode).Scan(&stats.TotalClicks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count clicks: %w", err)
+	}
+
+	query := `
+		SELECT to_char(date_trunc('day', clicked_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD') AS day, COUNT(*)
+		FROM clicks
+		WHERE domain = $1 AND short_code = $2 AND clicked_at >= NOW() - make_interval(days => $3)
+		GROUP BY day
+		ORDER BY day`
+
+	rows, err := r.db.db.QueryContext(ctx, query, domain, shortCode, days)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily clicks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.DailyClicks
+		if err := rows.Scan(&d.Date, &d.Clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan daily clicks: %w", err)
+		}
+		stats.ClicksPerDay = append(stats.ClicksPerDay, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get daily clicks: %w", err)
+	}
+
+	query = `
+		SELECT referrer, COUNT(*) AS clicks
+		FROM clicks
+		WHERE domain = $1 AND short_code = $2 AND referrer <> ''
+		GROUP BY referrer
+		ORDER BY clicks DESC, referrer
+		LIMIT $3`
+
+	refRows, err := r.db.db.QueryContext(ctx, query, domain, shortCode, topReferrers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top referrers: %w", err)
+	}
+	defer refRows.Close()
+
+	for refRows.Next() {
+		var rc models.ReferrerCount
+		if err := refRows.Scan(&rc.Referrer, &rc.Clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan top referrers: %w", err)
+		}
+		stats.TopReferrers = append(stats.TopReferrers, rc)
+	}
+	if err := refRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get top referrers: %w", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/ratelimit/ratelimittest"
+	"github.com/jonmanahan/url-shortener/internal/repository/repotest"
+)
+
+func TestMemoryURLRepository_Conformance(t *testing.T) {
+	repotest.TestURLRepository(t, func(t *testing.T) interfaces.URLRepository {
+		return NewMemoryURLRepository(NewMemoryStore())
+	})
+}
+
+func TestBoltURLRepository_Conformance(t *testing.T) {
+	repotest.TestURLRepository(t, func(t *testing.T) interfaces.URLRepository {
+		db := openTestBoltDB(t, filepath.Join(t.TempDir(), "links.db"))
+		t.Cleanup(func() { db.Close() })
+		return NewBoltURLRepository(db)
+	})
+}
+
+// TestPostgresURLRepository_Conformance runs against a migrated database
+// named by TEST_DATABASE_URL and is skipped without one.
+func TestPostgresURLRepository_Conformance(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := NewPostgresDB(databaseURL, Timeouts{Read: 5 * time.Second, Write: 5 * time.Second, Batch: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	repotest.TestURLRepository(t, func(t *testing.T) interfaces.URLRepository {
+		return NewURLRepository(db)
+	})
+}
+
+func TestMemoryClickRepository_Conformance(t *testing.T) {
+	repotest.TestClickRepository(t, func(t *testing.T) (interfaces.URLRepository, interfaces.ClickRepository) {
+		store := NewMemoryStore()
+		return NewMemoryURLRepository(store), NewMemoryClickRepository(store)
+	})
+}
+
+func TestBoltClickRepository_Conformance(t *testing.T) {
+	repotest.TestClickRepository(t, func(t *testing.T) (interfaces.URLRepository, interfaces.ClickRepository) {
+		db := openTestBoltDB(t, filepath.Join(t.TempDir(), "links.db"))
+		t.Cleanup(func() { db.Close() })
+		return NewBoltURLRepository(db), NewBoltClickRepository(db)
+	})
+}
+
+// TestPostgresClickRepository_Conformance runs against a migrated database
+// named by TEST_DATABASE_URL and is skipped without one.
+func TestPostgresClickRepository_Conformance(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := NewPostgresDB(databaseURL, Timeouts{Read: 5 * time.Second, Write: 5 * time.Second, Batch: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	repotest.TestClickRepository(t, func(t *testing.T) (interfaces.URLRepository, interfaces.ClickRepository) {
+		return NewURLRepository(db), NewClickRepository(db)
+	})
+}
+
+func TestMemoryUsageRepository_Conformance(t *testing.T) {
+	repotest.TestUsageRepository(t, func(t *testing.T) (interfaces.APIKeyRepository, interfaces.UsageRepository) {
+		store := NewMemoryStore()
+		return NewMemoryAPIKeyRepository(store), NewMemoryUsageRepository(store)
+	})
+}
+
+func TestBoltUsageRepository_Conformance(t *testing.T) {
+	repotest.TestUsageRepository(t, func(t *testing.T) (interfaces.APIKeyRepository, interfaces.UsageRepository) {
+		db := openTestBoltDB(t, filepath.Join(t.TempDir(), "links.db"))
+		t.Cleanup(func() { db.Close() })
+		return NewBoltAPIKeyRepository(db), NewBoltUsageRepository(db)
+	})
+}
+
+// TestPostgresUsageRepository_Conformance runs against a migrated database
+// named by TEST_DATABASE_URL and is skipped without one.
+func TestPostgresUsageRepository_Conformance(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := NewPostgresDB(databaseURL, Timeouts{Read: 5 * time.Second, Write: 5 * time.Second, Batch: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	repotest.TestUsageRepository(t, func(t *testing.T) (interfaces.APIKeyRepository, interfaces.UsageRepository) {
+		return NewAPIKeyRepository(db), NewUsageRepository(db)
+	})
+}
+
+// TestRedisRateLimiter_Conformance runs against the Redis server named by
+// TEST_REDIS_URL and is skipped without one.
+func TestRedisRateLimiter_Conformance(t *testing.T) {
+	redisURL := os.Getenv("TEST_REDIS_URL")
+	if redisURL == "" {
+		t.Skip("TEST_REDIS_URL not set")
+	}
+
+	client := NewRedisClient(redisURL)
+	t.Cleanup(func() { client.Close() })
+
+	ratelimittest.TestRateLimiter(t, func(t *testing.T, algorithm string) interfaces.RateLimiter {
+		limiter, err := NewRedisRateLimiter(client, algorithm)
+		if err != nil {
+			t.Fatalf("NewRedisRateLimiter failed: %v", err)
+		}
+		return limiter
+	})
+}
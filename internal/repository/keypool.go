@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+type KeyPoolRepository struct {
+	db *PostgresDB
+}
+
+func NewKeyPoolRepository(db *PostgresDB) *KeyPoolRepository {
+	return &KeyPoolRepository{db: db}
+}
+
+func (r *KeyPoolRepository) AddCodes(ctx context.Context, codes []string) (int, error) {
+	ctx, cancel := r.db.batchContext(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO short_code_pool (short_code)
+		SELECT DISTINCT c FROM unnest($1::text[]) AS c
+		WHERE NOT EXISTS (SELECT 1 FROM urls WHERE urls.short_code = c)
+		ON CONFLICT (short_code) DO NOTHING`
+
+	result, err := r.db.db.ExecContext(ctx, query, pq.Array(codes))
+	if err != nil {
+		return 0, fmt.Errorf("failed to add pooled codes: %w", err)
+	}
+
+	added, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to add pooled codes: %w", err)
+	}
+
+	return int(added), nil
+}
+
+// LeaseCodes uses SKIP LOCKED, so instances lease concurrently without
+// waiting on each other or receiving the same code.
+func (r *KeyPoolRepository) LeaseCodes(ctx context.Context, n int) ([]string, error) {
+	ctx, cancel := r.db.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		DELETE FROM short_code_pool
+		WHERE short_code IN (
+			SELECT short_code FROM short_code_pool
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING short_code`
+
+	rows, err := r.db.db.QueryContext(ctx, query, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease codes: %w", err)
+	}
+	defer rows.Close()
+
+	codes := make([]string, 0, n)
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, fmt.Errorf("failed to scan leased code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to lease codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+func (r *KeyPoolRepository) AvailableCodes(ctx context.Context) (int, error) {
+	ctx, cancel := r.db.readContext(ctx)
+	defer cancel()
+
+	var available int
+	if err := r.db.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM short_code_pool`).Scan(&available); err != nil {
+		return 0, fmt.Errorf("failed to count pooled codes: %w", err)
+	}
+	return available, nil
+}
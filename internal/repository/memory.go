@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// MemoryStore keeps links, clicks, API keys, usage and pooled codes in process
+// memory. It backs the Memory* repositories for local development and
+// tests; nothing survives a restart. All methods are safe for concurrent use.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	urls      map[memoryURLKey]*models.URL
+	nextURLID int
+	clicks    []models.ClickEvent
+	apiKeys   map[string]*models.APIKey // keyed by hash
+	nextKeyID int
+	usage     map[memoryUsageKey]int // links created per key and UTC day
+	pool      map[string]struct{}
+	sequence  uint64
+}
+
+type memoryURLKey struct {
+	domain    string
+	shortCode string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		urls:    make(map[memoryURLKey]*models.URL),
+		apiKeys: make(map[string]*models.APIKey),
+		usage:   make(map[memoryUsageKey]int),
+		pool:    make(map[string]struct{}),
+	}
+}
+
+// copyURL returns a copy so callers never share the stored link.
+func copyURL(u *models.URL) *models.URL {
+	c := *u
+	if u.ExpiresAt != nil {
+		expiresAt := *u.ExpiresAt
+		c.ExpiresAt = &expiresAt
+	}
+	return &c
+}
+
+// MemoryURLRepository is a URLRepository backed by a MemoryStore.
+type MemoryURLRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryURLRepository(store *MemoryStore) *MemoryURLRepository {
+	return &MemoryURLRepository{store: store}
+}
+
+// insert stores a new link and reports false if its short code is taken.
+// The caller must hold the write lock.
+func (r *MemoryURLRepository) insert(u *models.URL, now time.Time) (*models.URL, bool) {
+	key := memoryURLKey{domain: u.Domain, shortCode: u.ShortCode}
+	if _, taken := r.store.urls[key]; taken {
+		return nil, false
+	}
+
+	r.store.nextURLID++
+	url := copyURL(u)
+	url.ID = r.store.nextURLID
+	url.CreatedAt = now
+	url.UpdatedAt = now
+	r.store.urls[key] = url
+
+	return copyURL(url), true
+}
+
+func (r *MemoryURLRepository) CreateURL(ctx context.Context, u *models.URL) (*models.URL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to create URL: %w", err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	url, ok := r.insert(u, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("%w: short code %q is taken", interfaces.ErrConflict, u.ShortCode)
+	}
+	return url, nil
+}
+
+func (r *MemoryURLRepository) CreateURLs(ctx context.Context, urls []*models.URL) ([]*models.URL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to create URLs: %w", err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := time.Now()
+	created := make([]*models.URL, 0, len(urls))
+	for _, u := range urls {
+		if url, ok := r.insert(u, now); ok {
+			created = append(created, url)
+		}
+	}
+	return created, nil
+}
+
+func (r *MemoryURLRepository) GetURLByShortCode(ctx context.Context, domain, shortCode string) (*models.URL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get URL: %w", err)
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	url, ok := r.store.urls[memoryURLKey{domain: domain, shortCode: shortCode}]
+	if !ok {
+		return nil, interfaces.ErrNotFound
+	}
+	return copyURL(url), nil
+}
+
+func (r *MemoryURLRepository) UpdateURL(ctx context.Context, u *models.URL) (*models.URL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to update URL: %w", err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	url, ok := r.store.urls[memoryURLKey{domain: u.Domain, shortCode: u.ShortCode}]
+	if !ok {
+		return nil, interfaces.ErrNotFound
+	}
+	url.OriginalURL = u.OriginalURL
+	url.NormalizedURL = u.NormalizedURL
+	url.DestinationHash = u.DestinationHash
+	url.RedirectType = u.RedirectType
+	url.UpdatedAt = time.Now()
+
+	return copyURL(url), nil
+}
+
+func (r *MemoryURLRepository) DeleteURL(ctx context.Context, domain, shortCode string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to delete URL: %w", err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	key := memoryURLKey{domain: domain, shortCode: shortCode}
+	if _, ok := r.store.urls[key]; !ok {
+		return interfaces.ErrNotFound
+	}
+	delete(r.store.urls, key)
+
+	clicks := r.store.clicks[:0]
+	for _, e := range r.store.clicks {
+		if e.Domain != domain || e.ShortCode != shortCode {
+			clicks = append(clicks, e)
+		}
+	}
+	r.store.clicks = clicks
+	return nil
+}
+
+func (r *MemoryURLRepository) FindURLByDestination(ctx context.Context, ownerID, domain, destinationHash string) (*models.URL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find URL by destination: %w", err)
+	}
+
+	// Links without a stored owner or hash never match, as with NULL in Postgres
+	if ownerID == "" || destinationHash == "" {
+		return nil, interfaces.ErrNotFound
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	now := time.Now()
+	var oldest *models.URL
+	for _, url := range r.store.urls {
+		if url.OwnerID != ownerID || url.Domain != domain || url.DestinationHash != destinationHash || url.IsExpired(now) {
+			continue
+		}
+		if oldest == nil || url.ID < oldest.ID {
+			oldest = url
+		}
+	}
+	if oldest == nil {
+		return nil, interfaces.ErrNotFound
+	}
+	return copyURL(oldest), nil
+}
+
+func (r *MemoryURLRepository) ListURLsByOwner(ctx context.Context, ownerID string, limit, offset int) ([]*models.URL, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list URLs: %w", err)
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var owned []*models.URL
+	for _, url := range r.store.urls {
+		if url.OwnerID != "" && url.OwnerID == ownerID {
+			owned = append(owned, url)
+		}
+	}
+	// IDs increase with creation time, so they give a stable newest-first order
+	sort.Slice(owned, func(i, j int) bool { return owned[i].ID > owned[j].ID })
+
+	urls := []*models.URL{}
+	for i := offset; i < len(owned) && len(urls) < limit; i++ {
+		urls = append(urls, copyURL(owned[i]))
+	}
+	return urls, len(owned), nil
+}
+
+// MemorySequenceCounter hands out consecutive values starting at 0, like
+// the short_code_seq sequence.
+type MemorySequenceCounter struct {
+	store *MemoryStore
+}
+
+func NewMemorySequenceCounter(store *MemoryStore) *MemorySequenceCounter {
+	return &MemorySequenceCounter{store: store}
+}
+
+func (c *MemorySequenceCounter) Next(ctx context.Context) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("failed to reserve sequence values: %w", err)
+	}
+
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	n := c.store.sequence
+	c.store.sequence++
+	return n, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// MemoryAPIKeyRepository is an APIKeyRepository backed by a MemoryStore.
+// Plans are resolved from DefaultPlans.
+type MemoryAPIKeyRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryAPIKeyRepository(store *MemoryStore) *MemoryAPIKeyRepository {
+	return &MemoryAPIKeyRepository{store: store}
+}
+
+func (r *MemoryAPIKeyRepository) CreateAPIKey(ctx context.Context, k *models.APIKey) (*models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	plan := planOrDefault(k.Plan)
+	quota, ok := DefaultPlans[plan]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", interfaces.ErrUnknownPlan, plan)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, taken := r.store.apiKeys[k.KeyHash]; taken {
+		return nil, fmt.Errorf("%w: API key already exists", interfaces.ErrConflict)
+	}
+
+	r.store.nextKeyID++
+	key := &models.APIKey{
+		ID:        r.store.nextKeyID,
+		OwnerID:   k.OwnerID,
+		Name:      k.Name,
+		KeyHash:   k.KeyHash,
+		CreatedAt: time.Now(),
+		Plan:      plan,
+		Quota:     quota,
+	}
+	r.store.apiKeys[key.KeyHash] = key
+
+	created := *key
+	return &created, nil
+}
+
+func (r *MemoryAPIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	key, ok := r.store.apiKeys[keyHash]
+	if !ok || key.RevokedAt != nil {
+		return nil, interfaces.ErrInvalidAPIKey
+	}
+
+	found := *key
+	return &found, nil
+}
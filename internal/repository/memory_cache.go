@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+)
+
+// memoryCacheSweepEvery is how many writes pass between sweeps of expired
+// entries, so keys that are never read again do not accumulate.
+const memoryCacheSweepEvery = 1024
+
+type memoryCacheEntry struct {
+	value     string
+	expiresAt time.Time // zero means no expiry
+}
+
+func (e memoryCacheEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// MemoryCache is an in-process interfaces.Cache with the same expiry
+// semantics as RedisClient. It is safe for concurrent use but not shared
+// between instances.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+	writes  int
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]memoryCacheEntry)}
+}
+
+// Get returns interfaces.ErrNotFound for missing or expired keys.
+func (c *MemoryCache) Get(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || entry.expired(time.Now()) {
+		return "", interfaces.ErrNotFound
+	}
+	return entry.value, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key, value string, expiration time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(key, value, expiration, time.Now())
+	return nil
+}
+
+func (c *MemoryCache) SetMany(ctx context.Context, entries []interfaces.CacheEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, e := range entries {
+		c.set(e.Key, e.Value, e.Expiration, now)
+	}
+	return nil
+}
+
+func (c *MemoryCache) Del(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+	return nil
+}
+
+// set stores an entry and periodically sweeps expired ones. The caller must
+// hold c.mu.
+func (c *MemoryCache) set(key, value string, expiration time.Duration, now time.Time) {
+	entry := memoryCacheEntry{value: value}
+	if expiration > 0 {
+		entry.expiresAt = now.Add(expiration)
+	}
+	c.entries[key] = entry
+
+	c.writes++
+	if c.writes%memoryCacheSweepEvery == 0 {
+		for k, e := range c.entries {
+			if e.expired(now) {
+				delete(c.entries, k)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// MemoryClickRepository is a ClickRepository backed by a MemoryStore.
+type MemoryClickRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryClickRepository(store *MemoryStore) *MemoryClickRepository {
+	return &MemoryClickRepository{store: store}
+}
+
+func (r *MemoryClickRepository) InsertClicks(ctx context.Context, events []models.ClickEvent) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to insert clicks: %w", err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.clicks = append(r.store.clicks, events...)
+	return nil
+}
+
+func (r *MemoryClickRepository) GetLinkStats(ctx context.Context, domain, shortCode string, days, topReferrers int) (*models.LinkStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get link stats: %w", err)
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	stats := newLinkStatsBuilder(domain, shortCode, days)
+	for _, e := range r.store.clicks {
+		if e.Domain == domain && e.ShortCode == shortCode {
+			stats.add(e.ClickedAt, e.Referrer)
+		}
+	}
+
+	return stats.build(topReferrers), nil
+}
+
+// linkStatsBuilder aggregates clicks for stores without SQL, matching the
+// results of ClickRepository.GetLinkStats.
+type linkStatsBuilder struct {
+	stats     *models.LinkStats
+	since     time.Time
+	daily     map[string]int64
+	referrers map[string]int64
+}
+
+func newLinkStatsBuilder(domain, shortCode string, days int) *linkStatsBuilder {
+	return &linkStatsBuilder{
+		stats: &models.LinkStats{
+			ShortCode:    shortCode,
+			Domain:       domain,
+			ClicksPerDay: []models.DailyClicks{},
+			TopReferrers: []models.ReferrerCount{},
+		},
+		since:     time.Now().AddDate(0, 0, -days),
+		daily:     make(map[string]int64),
+		referrers: make(map[string]int64),
+	}
+}
+
+func (b *linkStatsBuilder) add(clickedAt time.Time, referrer string) {
+	b.stats.TotalClicks++
+	if !clickedAt.Before(b.since) {
+		b.daily[clickedAt.UTC().Format("2006-01-02")]++
+	}
+	if referrer != "" {
+		b.referrers[referrer]++
+	}
+}
+
+func (b *linkStatsBuilder) build(topReferrers int) *models.LinkStats {
+	stats := b.stats
+	for day, clicks := range b.daily {
+		stats.ClicksPerDay = append(stats.ClicksPerDay, models.DailyClicks{Date: day, Clicks: clicks})
+	}
+	sort.Slice(stats.ClicksPerDay, func(i, j int) bool {
+		return stats.ClicksPerDay[i].Date < stats.ClicksPerDay[j].Date
+	})
+
+	for referrer, clicks := range b.referrers {
+		stats.TopReferrers = append(stats.TopReferrers, models.ReferrerCount{Referrer: referrer, Clicks: clicks})
+	}
+	sort.Slice(stats.TopReferrers, func(i, j int) bool {
+		a, b := stats.TopReferrers[i], stats.TopReferrers[j]
+		if a.Clicks != b.Clicks {
+			return a.Clicks > b.Clicks
+		}
+		return a.Referrer < b.Referrer
+	})
+	if len(stats.TopReferrers) > topReferrers {
+		stats.TopReferrers = stats.TopReferrers[:topReferrers]
+	}
+
+	return stats
+}
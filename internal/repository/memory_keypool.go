@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// MemoryKeyPoolRepository is a KeyPoolRepository backed by a MemoryStore.
+type MemoryKeyPoolRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryKeyPoolRepository(store *MemoryStore) *MemoryKeyPoolRepository {
+	return &MemoryKeyPoolRepository{store: store}
+}
+
+func (r *MemoryKeyPoolRepository) AddCodes(ctx context.Context, codes []string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("failed to add pooled codes: %w", err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	used := make(map[string]bool, len(r.store.urls))
+	for key := range r.store.urls {
+		used[key.shortCode] = true
+	}
+
+	added := 0
+	for _, code := range codes {
+		if _, pooled := r.store.pool[code]; pooled || used[code] {
+			continue
+		}
+		r.store.pool[code] = struct{}{}
+		added++
+	}
+	return added, nil
+}
+
+func (r *MemoryKeyPoolRepository) LeaseCodes(ctx context.Context, n int) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to lease codes: %w", err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	codes := make([]string, 0, n)
+	for code := range r.store.pool {
+		if len(codes) == n {
+			break
+		}
+		codes = append(codes, code)
+		delete(r.store.pool, code)
+	}
+	return codes, nil
+}
+
+func (r *MemoryKeyPoolRepository) AvailableCodes(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("failed to count pooled codes: %w", err)
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return len(r.store.pool), nil
+}
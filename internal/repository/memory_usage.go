@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+type memoryUsageKey struct {
+	keyID int
+	day   string // usageDay
+}
+
+// MemoryUsageRepository is a UsageRepository backed by a MemoryStore.
+type MemoryUsageRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryUsageRepository(store *MemoryStore) *MemoryUsageRepository {
+	return &MemoryUsageRepository{store: store}
+}
+
+func (r *MemoryUsageRepository) ReserveLinks(ctx context.Context, key *models.APIKey, n int, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to count links: %w", err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	day, month := r.count(key.ID, now)
+	if err := checkQuota(key.Quota, day, month, n, now); err != nil {
+		return err
+	}
+
+	r.store.usage[memoryUsageKey{keyID: key.ID, day: usageDay(now)}] += n
+	return nil
+}
+
+func (r *MemoryUsageRepository) ReleaseLinks(ctx context.Context, keyID, n int, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to release links: %w", err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	k := memoryUsageKey{keyID: keyID, day: usageDay(now)}
+	if used, ok := r.store.usage[k]; ok {
+		r.store.usage[k] = max(used-n, 0)
+	}
+	return nil
+}
+
+func (r *MemoryUsageRepository) CountLinks(ctx context.Context, keyID int, now time.Time) (int, int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to count links: %w", err)
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	day, month := r.count(keyID, now)
+	return day, month, nil
+}
+
+// count sums the key's links on now's day and in now's month. The caller
+// must hold the lock.
+func (r *MemoryUsageRepository) count(keyID int, now time.Time) (day, month int) {
+	today, thisMonth := usageDay(now), usageMonth(now)
+	for k, used := range r.store.usage {
+		if k.keyID != keyID || !strings.HasPrefix(k.day, thisMonth) {
+			continue
+		}
+		month += used
+		if k.day == today {
+			day = used
+		}
+	}
+	return day, month
+}
@@ -1,34 +1,106 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
 	"github.com/jonmanahan/url-shortener/internal/models"
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq" // PostgreSQL driver
 )
 
+// uniqueViolation is the Postgres error code for a unique constraint failure.
+const uniqueViolation = "23505"
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// foreignKeyViolation is the Postgres error code for a reference to a
+// missing row.
+const foreignKeyViolation = "23503"
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation
+}
+
+// Timeouts bounds how long each kind of database operation may run on top of
+// any deadline already on the caller's context. Zero means no extra limit.
+type Timeouts struct {
+	// Read applies to single lookups and listings.
+	Read time.Duration
+	// Write applies to single inserts, updates and deletes.
+	Write time.Duration
+	// Batch applies to bulk inserts and aggregations.
+	Batch time.Duration
+}
+
 type PostgresDB struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts Timeouts
 }
 
-func NewPostgresDB(databaseURL string) (*PostgresDB, error) {
-	db, err := sql.Open("postgres", databaseURL)
+// NewPostgresDB opens the database and checks that it is reachable.
+func NewPostgresDB(databaseURL string, timeouts Timeouts) (*PostgresDB, error) {
+	p, err := OpenPostgresDB(databaseURL, timeouts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
-	if err := db.Ping(); err != nil {
+	if err := p.db.Ping(); err != nil {
+		p.db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &PostgresDB{db: db}, nil
+	return p, nil
+}
+
+// OpenPostgresDB prepares the connection pool without connecting, so the
+// server can start while the database is down. Connections are made on first
+// use and re-established after failures.
+func OpenPostgresDB(databaseURL string, timeouts Timeouts) (*PostgresDB, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	return &PostgresDB{db: db, timeouts: timeouts}, nil
+}
+
+// Ping checks that the database is reachable.
+func (p *PostgresDB) Ping(ctx context.Context) error {
+	return p.db.PingContext(ctx)
 }
 
 func (p *PostgresDB) Close() error {
 	return p.db.Close()
 }
 
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (p *PostgresDB) readContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, p.timeouts.Read)
+}
+
+func (p *PostgresDB) writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, p.timeouts.Write)
+}
+
+func (p *PostgresDB) batchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, p.timeouts.Batch)
+}
+
 type URLRepository struct {
 	db *PostgresDB
 }
@@ -37,41 +109,140 @@ func NewURLRepository(db *PostgresDB) *URLRepository {
 	return &URLRepository{db: db}
 }
 
-func (r *URLRepository) CreateURL(originalURL, shortCode string) (*models.URL, error) {
-	query := `
-		INSERT INTO urls (original_url, short_code, created_at, updated_at)
-		VALUES ($1, $2, NOW(), NOW())
-		RETURNING id, original_url, short_code, created_at, updated_at`
+// urlColumns is the column list scanned by scanURL.
+const urlColumns = `id, original_url, COALESCE(normalized_url, ''), short_code, domain, COALESCE(owner_id, ''), COALESCE(destination_hash, ''), redirect_type, expires_at, created_at, updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
+func scanURL(row rowScanner) (*models.URL, error) {
 	url := &models.URL{}
-	err := r.db.db.QueryRow(query, originalURL, shortCode).Scan(
+	err := row.Scan(
 		&url.ID,
 		&url.OriginalURL,
+		&url.NormalizedURL,
 		&url.ShortCode,
+		&url.Domain,
+		&url.OwnerID,
+		&url.DestinationHash,
+		&url.RedirectType,
+		&url.ExpiresAt,
 		&url.CreatedAt,
 		&url.UpdatedAt,
 	)
 	if err != nil {
+		return nil, err
+	}
+	return url, nil
+}
+
+func (r *URLRepository) CreateURL(ctx context.Context, u *models.URL) (*models.URL, error) {
+	ctx, cancel := r.db.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO urls (original_url, normalized_url, short_code, domain, owner_id, destination_hash, redirect_type, expires_at, created_at, updated_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8, NOW(), NOW())
+		RETURNING ` + urlColumns
+
+	url, err := scanURL(r.db.db.QueryRowContext(ctx, query, u.OriginalURL, u.NormalizedURL, u.ShortCode, u.Domain, u.OwnerID, u.DestinationHash, u.RedirectType, u.ExpiresAt))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("%w: short code %q is taken", interfaces.ErrConflict, u.ShortCode)
+		}
 		return nil, fmt.Errorf("failed to create URL: %w", err)
 	}
 
 	return url, nil
 }
 
-func (r *URLRepository) GetURLByShortCode(shortCode string) (*models.URL, error) {
-	query := `SELECT id, original_url, short_code, created_at, updated_at FROM urls WHERE short_code = $1`
+// createURLsChunkSize keeps each multi-row INSERT well under Postgres's
+// 65535 bind parameter limit.
+const createURLsChunkSize = 500
 
-	url := &models.URL{}
-	err := r.db.db.QueryRow(query, shortCode).Scan(
-		&url.ID,
-		&url.OriginalURL,
-		&url.ShortCode,
-		&url.CreatedAt,
-		&url.UpdatedAt,
-	)
+// CreateURLs inserts the links in one transaction, in chunks of
+// createURLsChunkSize rows.
+func (r *URLRepository) CreateURLs(ctx context.Context, urls []*models.URL) ([]*models.URL, error) {
+	ctx, cancel := r.db.batchContext(ctx)
+	defer cancel()
+
+	tx, err := r.db.db.BeginTx(ctx, nil)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("URL not found")
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	created := make([]*models.URL, 0, len(urls))
+	for start := 0; start < len(urls); start += createURLsChunkSize {
+		end := start + createURLsChunkSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+
+		inserted, err := createURLChunk(ctx, tx, urls[start:end])
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, inserted...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit URLs: %w", err)
+	}
+
+	return created, nil
+}
+
+func createURLChunk(ctx context.Context, tx *sql.Tx, chunk []*models.URL) ([]*models.URL, error) {
+	const columns = 8
+	values := make([]string, 0, len(chunk))
+	args := make([]interface{}, 0, len(chunk)*columns)
+	for i, u := range chunk {
+		n := i * columns
+		values = append(values, fmt.Sprintf("($%d, NULLIF($%d, ''), $%d, $%d, NULLIF($%d, ''), NULLIF($%d, ''), $%d, $%d, NOW(), NOW())",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8))
+		args = append(args, u.OriginalURL, u.NormalizedURL, u.ShortCode, u.Domain, u.OwnerID, u.DestinationHash, u.RedirectType, u.ExpiresAt)
+	}
+
+	query := `
+		INSERT INTO urls (original_url, normalized_url, short_code, domain, owner_id, destination_hash, redirect_type, expires_at, created_at, updated_at)
+		VALUES ` + strings.Join(values, ", ") + `
+		ON CONFLICT (domain, short_code) DO NOTHING
+		RETURNING ` + urlColumns
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create URLs: %w", err)
+	}
+	defer rows.Close()
+
+	created := make([]*models.URL, 0, len(chunk))
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan URL: %w", err)
+		}
+		created = append(created, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to create URLs: %w", err)
+	}
+
+	return created, nil
+}
+
+func (r *URLRepository) GetURLByShortCode(ctx context.Context, domain, shortCode string) (*models.URL, error) {
+	ctx, cancel := r.db.readContext(ctx)
+	defer cancel()
+
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE domain = $1 AND short_code = $2`
+
+	url, err := scanURL(r.db.db.QueryRowContext(ctx, query, domain, shortCode))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, interfaces.ErrNotFound
 		}
 		return nil, fmt.Errorf("failed to get URL: %w", err)
 	}
@@ -79,14 +250,118 @@ func (r *URLRepository) GetURLByShortCode(shortCode string) (*models.URL, error)
 	return url, nil
 }
 
-func (r *URLRepository) ShortCodeExists(shortCode string) (bool, error) {
-	query := `SELECT EXISTS(SELECT 1 FROM urls WHERE short_code = $1)`
+func (r *URLRepository) UpdateURL(ctx context.Context, u *models.URL) (*models.URL, error) {
+	ctx, cancel := r.db.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE urls SET original_url = $3, normalized_url = NULLIF($4, ''), destination_hash = NULLIF($5, ''),
+			redirect_type = $6, updated_at = NOW()
+		WHERE domain = $1 AND short_code = $2
+		RETURNING ` + urlColumns
+
+	url, err := scanURL(r.db.db.QueryRowContext(ctx, query, u.Domain, u.ShortCode, u.OriginalURL, u.NormalizedURL, u.DestinationHash, u.RedirectType))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, interfaces.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to update URL: %w", err)
+	}
+
+	return url, nil
+}
+
+// DeleteURL deletes the link and its clicks in one transaction.
+func (r *URLRepository) DeleteURL(ctx context.Context, domain, shortCode string) error {
+	ctx, cancel := r.db.writeContext(ctx)
+	defer cancel()
+
+	tx, err := r.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM urls WHERE domain = $1 AND short_code = $2`, domain, shortCode)
+	if err != nil {
+		return fmt.Errorf("failed to delete URL: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete URL: %w", err)
+	}
+	if rows == 0 {
+		return interfaces.ErrNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM clicks WHERE domain = $1 AND short_code = $2`, domain, shortCode); err != nil {
+		return fmt.Errorf("failed to delete clicks: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit delete: %w", err)
+	}
+
+	return nil
+}
+
+func (r *URLRepository) FindURLByDestination(ctx context.Context, ownerID, domain, destinationHash string) (*models.URL, error) {
+	ctx, cancel := r.db.readContext(ctx)
+	defer cancel()
+
+	query := `
+		SELECT ` + urlColumns + `
+		FROM urls
+		WHERE owner_id = $1 AND destination_hash = $2 AND domain = $3
+		  AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY created_at, id
+		LIMIT 1`
+
+	url, err := scanURL(r.db.db.QueryRowContext(ctx, query, ownerID, destinationHash, domain))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, interfaces.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find URL by destination: %w", err)
+	}
+
+	return url, nil
+}
+
+func (r *URLRepository) ListURLsByOwner(ctx context.Context, ownerID string, limit, offset int) ([]*models.URL, int, error) {
+	ctx, cancel := r.db.readContext(ctx)
+	defer cancel()
 
-	var exists bool
-	err := r.db.db.QueryRow(query, shortCode).Scan(&exists)
+	var total int
+	err := r.db.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM urls WHERE owner_id = $1`, ownerID).Scan(&total)
 	if err != nil {
-		return false, fmt.Errorf("failed to check if short code exists: %w", err)
+		return nil, 0, fmt.Errorf("failed to count URLs: %w", err)
+	}
+
+	query := `
+		SELECT ` + urlColumns + `
+		FROM urls WHERE owner_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`
+
+	rows, err := r.db.db.QueryContext(ctx, query, ownerID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list URLs: %w", err)
+	}
+	defer rows.Close()
+
+	urls := []*models.URL{}
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan URL: %w", err)
+		}
+		urls = append(urls, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list URLs: %w", err)
 	}
 
-	return exists, nil
+	return urls, total, nil
 }
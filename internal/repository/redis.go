@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -29,27 +30,74 @@ func (r *RedisClient) Close() error {
 	return r.client.Close()
 }
 
+// Ping checks that Redis is reachable.
+func (r *RedisClient) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
 func (r *RedisClient) Set(ctx context.Context, key, value string, expiration time.Duration) error {
 	return r.client.Set(ctx, key, value, expiration).Err()
 }
 
+// SetMany writes all entries in a single pipeline round trip.
+func (r *RedisClient) SetMany(ctx context.Context, entries []interfaces.CacheEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	pipe := r.client.Pipeline()
+	for _, e := range entries {
+		pipe.Set(ctx, e.Key, e.Value, e.Expiration)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
 func (r *RedisClient) Get(ctx context.Context, key string) (string, error) {
 	return r.client.Get(ctx, key).Result()
 }
 
+func (r *RedisClient) Del(ctx context.Context, keys ...string) error {
+	return r.client.Del(ctx, keys...).Err()
+}
+
 func (r *RedisClient) Exists(ctx context.Context, key string) (bool, error) {
 	count, err := r.client.Exists(ctx, key).Result()
 	return count > 0, err
 }
 
-// Rate limiting functions
-func (r *RedisClient) IncrementWithExpiry(ctx context.Context, key string, expiration time.Duration) (int64, error) {
-	pipe := r.client.TxPipeline()
-	incrCmd := pipe.Incr(ctx, key)
-	pipe.Expire(ctx, key, expiration)
-	_, err := pipe.Exec(ctx)
-	if err != nil {
-		return 0, err
-	}
-	return incrCmd.Val(), nil
+// Publish sends message to the subscribers of channel.
+func (r *RedisClient) Publish(ctx context.Context, channel, message string) error {
+	return r.client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe delivers messages published on channel until ctx is done. The
+// subscription reconnects on its own after connection errors; messages
+// published while disconnected are lost.
+func (r *RedisClient) Subscribe(ctx context.Context, channel string) <-chan string {
+	sub := r.client.Subscribe(ctx, channel)
+	messages := make(chan string)
+
+	go func() {
+		defer close(messages)
+		defer sub.Close()
+
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case messages <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return messages
 }
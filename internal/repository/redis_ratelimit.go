@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// The scripts take the time from Redis, so all instances share one clock,
+// and work in milliseconds. Each returns whether the request was allowed
+// followed by the state ratelimit needs to build the result.
+var (
+	// slidingLogScript keeps a sorted set of request times.
+	// KEYS[1]: the log; ARGV: limit, period, unique request id.
+	// Returns: allowed, count, age of oldest entry, age of newest entry.
+	slidingLogScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - period)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, now .. ':' .. ARGV[3])
+	count = count + 1
+	allowed = 1
+end
+
+local oldest, newest = now, now
+if count > 0 then
+	oldest = tonumber(redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')[2])
+	newest = tonumber(redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')[2])
+	redis.call('PEXPIREAT', KEYS[1], newest + period)
+end
+return {allowed, count, now - oldest, now - newest}
+`)
+
+	// slidingWindowScript keeps one counter per fixed window in two hashes
+	// used in turn by even and odd windows. Each holds its window's index
+	// (w) and count (n), so a count left from an older window reads as 0.
+	// KEYS[1], KEYS[2]: the even and odd window counters; ARGV: limit, period.
+	// Returns: allowed, previous count, current count, time into window.
+	slidingWindowScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+
+local window = math.floor(now / period)
+local elapsed = now - window * period
+local current = KEYS[1 + window % 2]
+local previous = KEYS[2 - window % 2]
+
+local function count(key, w)
+	local v = redis.call('HMGET', key, 'w', 'n')
+	if tonumber(v[1]) == w then
+		return tonumber(v[2]) or 0
+	end
+	return 0
+end
+local prev = count(previous, window - 1)
+local curr = count(current, window)
+
+local allowed = 0
+if prev * (1 - elapsed / period) + curr + 1 <= limit then
+	curr = curr + 1
+	redis.call('HSET', current, 'w', string.format('%d', window), 'n', curr)
+	redis.call('PEXPIRE', current, 2 * period)
+	allowed = 1
+end
+return {allowed, prev, curr, elapsed}
+`)
+
+	// tokenBucketScript stores GCRA's theoretical arrival time.
+	// KEYS[1]: the arrival time; ARGV: period, emission interval.
+	// Returns: allowed, how far the arrival time lies ahead of now.
+	tokenBucketScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + tonumber(t[2]) / 1000
+local period = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tat < now then
+	tat = now
+end
+
+local allowed = 0
+if now >= tat + interval - period then
+	tat = tat + interval
+	redis.call('SET', KEYS[1], string.format('%.3f', tat), 'PX', math.ceil(tat - now))
+	allowed = 1
+end
+return {allowed, math.ceil(tat - now)}
+`)
+)
+
+// RedisRateLimiter runs the ratelimit algorithms as atomic Redis scripts, so
+// limits hold across all instances sharing the Redis server.
+type RedisRateLimiter struct {
+	client    *redis.Client
+	algorithm string
+}
+
+// NewRedisRateLimiter returns a limiter using the given ratelimit algorithm.
+func NewRedisRateLimiter(r *RedisClient, algorithm string) (*RedisRateLimiter, error) {
+	algorithm, err := ratelimit.Normalize(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisRateLimiter{client: r.client, algorithm: algorithm}, nil
+}
+
+func (l *RedisRateLimiter) Allow(ctx context.Context, key string, limit interfaces.RateLimit) (interfaces.RateLimitResult, error) {
+	if ratelimit.Disabled(limit) {
+		return interfaces.RateLimitResult{Allowed: true}, nil
+	}
+
+	period := limit.Period.Milliseconds()
+	switch l.algorithm {
+	case ratelimit.AlgorithmSlidingLog:
+		id, err := requestID()
+		if err != nil {
+			return interfaces.RateLimitResult{}, err
+		}
+		v, err := slidingLogScript.Run(ctx, l.client, []string{key}, limit.Requests, period, id).Int64Slice()
+		if err != nil {
+			return interfaces.RateLimitResult{}, fmt.Errorf("failed to check rate limit: %w", err)
+		}
+		return ratelimit.SlidingLogResult(limit, v[0] == 1, int(v[1]), milliseconds(v[2]), milliseconds(v[3])), nil
+
+	case ratelimit.AlgorithmTokenBucket:
+		interval := float64(ratelimit.EmissionInterval(limit)) / float64(time.Millisecond)
+		v, err := tokenBucketScript.Run(ctx, l.client, []string{key}, period, strconv.FormatFloat(interval, 'f', -1, 64)).Int64Slice()
+		if err != nil {
+			return interfaces.RateLimitResult{}, fmt.Errorf("failed to check rate limit: %w", err)
+		}
+		return ratelimit.TokenBucketResult(limit, v[0] == 1, milliseconds(v[1])), nil
+
+	default:
+		v, err := slidingWindowScript.Run(ctx, l.client, slidingWindowKeys(key), limit.Requests, period).Int64Slice()
+		if err != nil {
+			return interfaces.RateLimitResult{}, fmt.Errorf("failed to check rate limit: %w", err)
+		}
+		return ratelimit.SlidingWindowResult(limit, v[0] == 1, int(v[1]), int(v[2]), milliseconds(v[3])), nil
+	}
+}
+
+// slidingWindowKeys names the even and odd window counters for key. The
+// shared hash tag keeps both in one Redis Cluster slot.
+func slidingWindowKeys(key string) []string {
+	tag := "{" + key + "}"
+	return []string{tag + ":even", tag + ":odd"}
+}
+
+// requestID tells apart requests logged in the same millisecond.
+func requestID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func milliseconds(ms int64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
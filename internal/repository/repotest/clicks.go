@@ -0,0 +1,98 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// ClickFactory returns the URL and click repositories under test, which must
+// share storage. It is called once per subtest.
+type ClickFactory func(t *testing.T) (interfaces.URLRepository, interfaces.ClickRepository)
+
+// TestClickRepository runs the click conformance suite against the
+// repositories returned by newRepos.
+func TestClickRepository(t *testing.T, newRepos ClickFactory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, urls interfaces.URLRepository, clicks interfaces.ClickRepository)
+	}{
+		{"LinkStats", testLinkStats},
+		{"DeleteURLDeletesClicks", testDeleteURLDeletesClicks},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urls, clicks := newRepos(t)
+			tt.fn(t, urls, clicks)
+		})
+	}
+}
+
+func insertClicks(t *testing.T, clicks interfaces.ClickRepository, url *models.URL, referrers ...string) {
+	t.Helper()
+	events := make([]models.ClickEvent, len(referrers))
+	for i, referrer := range referrers {
+		events[i] = models.ClickEvent{
+			ShortCode: url.ShortCode,
+			Domain:    url.Domain,
+			ClickedAt: time.Now(),
+			Referrer:  referrer,
+			IPAddress: "192.0.2.0",
+		}
+	}
+	if err := clicks.InsertClicks(context.Background(), events); err != nil {
+		t.Fatalf("InsertClicks failed: %v", err)
+	}
+}
+
+func getStats(t *testing.T, clicks interfaces.ClickRepository, url *models.URL) *models.LinkStats {
+	t.Helper()
+	stats, err := clicks.GetLinkStats(context.Background(), url.Domain, url.ShortCode, 30, 10)
+	if err != nil {
+		t.Fatalf("GetLinkStats failed: %v", err)
+	}
+	return stats
+}
+
+func testLinkStats(t *testing.T, urls interfaces.URLRepository, clicks interfaces.ClickRepository) {
+	url := mustCreate(t, urls, newURL(t, testDomain, "owner-"+unique(t)))
+	other := mustCreate(t, urls, newURL(t, "", "owner-"+unique(t)))
+
+	insertClicks(t, clicks, url, "https://a.example", "https://a.example", "https://b.example")
+	insertClicks(t, clicks, other, "https://a.example")
+
+	stats := getStats(t, clicks, url)
+	if stats.TotalClicks != 3 {
+		t.Errorf("Expected 3 clicks, got %d", stats.TotalClicks)
+	}
+	if len(stats.ClicksPerDay) != 1 || stats.ClicksPerDay[0].Clicks != 3 {
+		t.Errorf("Expected 3 clicks today, got %+v", stats.ClicksPerDay)
+	}
+	if len(stats.TopReferrers) != 2 || stats.TopReferrers[0].Referrer != "https://a.example" || stats.TopReferrers[0].Clicks != 2 {
+		t.Errorf("Expected https://a.example as top referrer with 2 clicks, got %+v", stats.TopReferrers)
+	}
+}
+
+func testDeleteURLDeletesClicks(t *testing.T, urls interfaces.URLRepository, clicks interfaces.ClickRepository) {
+	ctx := context.Background()
+	url := mustCreate(t, urls, newURL(t, "", "owner-"+unique(t)))
+	insertClicks(t, clicks, url, "https://a.example", "")
+
+	if err := urls.DeleteURL(ctx, url.Domain, url.ShortCode); err != nil {
+		t.Fatalf("DeleteURL failed: %v", err)
+	}
+
+	// Another owner claiming the code must not see the old link's clicks
+	reused := newURL(t, url.Domain, "owner-"+unique(t))
+	reused.ShortCode = url.ShortCode
+	mustCreate(t, urls, reused)
+
+	stats := getStats(t, clicks, reused)
+	if stats.TotalClicks != 0 || len(stats.ClicksPerDay) != 0 || len(stats.TopReferrers) != 0 {
+		t.Errorf("Expected no stats for the recreated link, got %+v", stats)
+	}
+}
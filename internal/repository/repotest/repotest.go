@@ -0,0 +1,441 @@
+// Package repotest holds conformance suites for storage backends. Every
+// backend should pass TestURLRepository, TestClickRepository and
+// TestUsageRepository:
+//
+//	func TestMyURLRepository_Conformance(t *testing.T) {
+//		repotest.TestURLRepository(t, func(t *testing.T) interfaces.URLRepository {
+//			return newMyRepository(t)
+//		})
+//	}
+//
+// The suite only creates links with fresh random short codes and owners, so
+// it can run against a shared database that already holds data.
+package repotest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// concurrentCreates is how many goroutines race in the concurrency tests.
+const concurrentCreates = 20
+
+// testDomain is a non-primary short domain used alongside the primary ("").
+const testDomain = "conformance.example.com"
+
+// Factory returns the repository under test. It is called once per subtest;
+// repositories may share storage between calls.
+type Factory func(t *testing.T) interfaces.URLRepository
+
+// TestURLRepository runs the conformance suite against the repositories
+// returned by newRepo.
+func TestURLRepository(t *testing.T, newRepo Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo interfaces.URLRepository)
+	}{
+		{"CreateAndLookup", testCreateAndLookup},
+		{"DomainsAreIndependent", testDomainsAreIndependent},
+		{"DuplicateCodeConflict", testDuplicateCodeConflict},
+		{"NotFound", testNotFound},
+		{"CreateURLsSkipsTakenCodes", testCreateURLsSkipsTakenCodes},
+		{"UpdateURL", testUpdateURL},
+		{"DeleteURL", testDeleteURL},
+		{"ListURLsByOwner", testListURLsByOwner},
+		{"FindURLByDestination", testFindURLByDestination},
+		{"ConcurrentCreatesSameCode", testConcurrentCreatesSameCode},
+		{"ConcurrentCreatesDistinctCodes", testConcurrentCreatesDistinctCodes},
+		{"CanceledContext", testCanceledContext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+// unique returns a random alphanumeric token so tests never collide with
+// existing rows or each other.
+func unique(t *testing.T) string {
+	t.Helper()
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func newURL(t *testing.T, domain, owner string) *models.URL {
+	return &models.URL{
+		OriginalURL:  "https://example.com/" + unique(t),
+		ShortCode:    "c" + unique(t),
+		Domain:       domain,
+		OwnerID:      owner,
+		RedirectType: 302,
+	}
+}
+
+func mustCreate(t *testing.T, repo interfaces.URLRepository, url *models.URL) *models.URL {
+	t.Helper()
+	created, err := repo.CreateURL(context.Background(), url)
+	if err != nil {
+		t.Fatalf("CreateURL(%s) failed: %v", url.ShortCode, err)
+	}
+	return created
+}
+
+func testCreateAndLookup(t *testing.T, repo interfaces.URLRepository) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	url := &models.URL{
+		OriginalURL:     "https://example.com/Path?q=1",
+		NormalizedURL:   "https://example.com/Path?q=1",
+		ShortCode:       "c" + unique(t),
+		Domain:          testDomain,
+		OwnerID:         "owner-" + unique(t),
+		DestinationHash: unique(t),
+		RedirectType:    308,
+		ExpiresAt:       &expiresAt,
+	}
+
+	created, err := repo.CreateURL(ctx, url)
+	if err != nil {
+		t.Fatalf("CreateURL failed: %v", err)
+	}
+	if created.ID == 0 {
+		t.Error("Expected created link to have an ID")
+	}
+	if created.CreatedAt.IsZero() || created.UpdatedAt.IsZero() {
+		t.Error("Expected created link to have timestamps")
+	}
+
+	assertSameLink(t, "CreateURL", created, url)
+
+	found, err := repo.GetURLByShortCode(ctx, url.Domain, url.ShortCode)
+	if err != nil {
+		t.Fatalf("GetURLByShortCode failed: %v", err)
+	}
+	assertSameLink(t, "GetURLByShortCode", found, url)
+	if found.ID != created.ID {
+		t.Errorf("GetURLByShortCode ID = %d, want %d", found.ID, created.ID)
+	}
+}
+
+// assertSameLink compares the stored fields of a link with what was written.
+func assertSameLink(t *testing.T, source string, got, want *models.URL) {
+	t.Helper()
+	if got.OriginalURL != want.OriginalURL || got.NormalizedURL != want.NormalizedURL ||
+		got.ShortCode != want.ShortCode || got.Domain != want.Domain || got.OwnerID != want.OwnerID ||
+		got.DestinationHash != want.DestinationHash || got.RedirectType != want.RedirectType {
+		t.Errorf("%s returned %+v, want fields of %+v", source, got, want)
+	}
+	switch {
+	case (got.ExpiresAt == nil) != (want.ExpiresAt == nil):
+		t.Errorf("%s ExpiresAt = %v, want %v", source, got.ExpiresAt, want.ExpiresAt)
+	case got.ExpiresAt != nil && !got.ExpiresAt.Equal(*want.ExpiresAt):
+		t.Errorf("%s ExpiresAt = %v, want %v", source, *got.ExpiresAt, *want.ExpiresAt)
+	}
+}
+
+func testDomainsAreIndependent(t *testing.T, repo interfaces.URLRepository) {
+	ctx := context.Background()
+	primary := newURL(t, "", "")
+	other := newURL(t, testDomain, "")
+	other.ShortCode = primary.ShortCode
+
+	mustCreate(t, repo, primary)
+	mustCreate(t, repo, other)
+
+	found, err := repo.GetURLByShortCode(ctx, testDomain, primary.ShortCode)
+	if err != nil {
+		t.Fatalf("GetURLByShortCode failed: %v", err)
+	}
+	if found.OriginalURL != other.OriginalURL {
+		t.Errorf("Expected the %s link, got destination %s", testDomain, found.OriginalURL)
+	}
+}
+
+func testDuplicateCodeConflict(t *testing.T, repo interfaces.URLRepository) {
+	ctx := context.Background()
+	first := mustCreate(t, repo, newURL(t, "", ""))
+
+	duplicate := newURL(t, "", "")
+	duplicate.ShortCode = first.ShortCode
+	if _, err := repo.CreateURL(ctx, duplicate); !errors.Is(err, interfaces.ErrConflict) {
+		t.Fatalf("Expected ErrConflict for a taken code, got %v", err)
+	}
+
+	found, err := repo.GetURLByShortCode(ctx, "", first.ShortCode)
+	if err != nil {
+		t.Fatalf("GetURLByShortCode failed: %v", err)
+	}
+	if found.OriginalURL != first.OriginalURL {
+		t.Errorf("Conflicting create changed the link to %s", found.OriginalURL)
+	}
+}
+
+func testNotFound(t *testing.T, repo interfaces.URLRepository) {
+	ctx := context.Background()
+	missing := newURL(t, testDomain, "owner-"+unique(t))
+
+	if _, err := repo.GetURLByShortCode(ctx, missing.Domain, missing.ShortCode); !errors.Is(err, interfaces.ErrNotFound) {
+		t.Errorf("GetURLByShortCode: expected ErrNotFound, got %v", err)
+	}
+	if _, err := repo.UpdateURL(ctx, missing); !errors.Is(err, interfaces.ErrNotFound) {
+		t.Errorf("UpdateURL: expected ErrNotFound, got %v", err)
+	}
+	if err := repo.DeleteURL(ctx, missing.Domain, missing.ShortCode); !errors.Is(err, interfaces.ErrNotFound) {
+		t.Errorf("DeleteURL: expected ErrNotFound, got %v", err)
+	}
+	if _, err := repo.FindURLByDestination(ctx, missing.OwnerID, missing.Domain, unique(t)); !errors.Is(err, interfaces.ErrNotFound) {
+		t.Errorf("FindURLByDestination: expected ErrNotFound, got %v", err)
+	}
+
+	// A link on one domain is not found on another
+	created := mustCreate(t, repo, newURL(t, "", ""))
+	if _, err := repo.GetURLByShortCode(ctx, testDomain, created.ShortCode); !errors.Is(err, interfaces.ErrNotFound) {
+		t.Errorf("GetURLByShortCode on another domain: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testCreateURLsSkipsTakenCodes(t *testing.T, repo interfaces.URLRepository) {
+	ctx := context.Background()
+	taken := mustCreate(t, repo, newURL(t, "", ""))
+
+	clash := newURL(t, "", "")
+	clash.ShortCode = taken.ShortCode
+	fresh := []*models.URL{newURL(t, "", ""), newURL(t, testDomain, "")}
+
+	created, err := repo.CreateURLs(ctx, []*models.URL{fresh[0], clash, fresh[1]})
+	if err != nil {
+		t.Fatalf("CreateURLs failed: %v", err)
+	}
+	if len(created) != len(fresh) {
+		t.Fatalf("Expected %d links created, got %d", len(fresh), len(created))
+	}
+	for _, url := range fresh {
+		if _, err := repo.GetURLByShortCode(ctx, url.Domain, url.ShortCode); err != nil {
+			t.Errorf("Expected %s to be created, got %v", url.ShortCode, err)
+		}
+	}
+
+	found, err := repo.GetURLByShortCode(ctx, "", taken.ShortCode)
+	if err != nil || found.OriginalURL != taken.OriginalURL {
+		t.Errorf("Skipped link changed the existing one: %+v, %v", found, err)
+	}
+}
+
+func testUpdateURL(t *testing.T, repo interfaces.URLRepository) {
+	ctx := context.Background()
+	owner := "owner-" + unique(t)
+	created := mustCreate(t, repo, newURL(t, testDomain, owner))
+
+	update := &models.URL{
+		OriginalURL:     "https://example.org/new",
+		NormalizedURL:   "https://example.org/new",
+		ShortCode:       created.ShortCode,
+		Domain:          created.Domain,
+		DestinationHash: unique(t),
+		RedirectType:    301,
+	}
+	updated, err := repo.UpdateURL(ctx, update)
+	if err != nil {
+		t.Fatalf("UpdateURL failed: %v", err)
+	}
+	if updated.OriginalURL != update.OriginalURL || updated.RedirectType != 301 || updated.DestinationHash != update.DestinationHash {
+		t.Errorf("UpdateURL returned %+v", updated)
+	}
+	if updated.OwnerID != owner || updated.ID != created.ID {
+		t.Errorf("UpdateURL changed identity fields: %+v", updated)
+	}
+
+	found, err := repo.GetURLByShortCode(ctx, created.Domain, created.ShortCode)
+	if err != nil {
+		t.Fatalf("GetURLByShortCode failed: %v", err)
+	}
+	if found.OriginalURL != update.OriginalURL || found.RedirectType != 301 {
+		t.Errorf("Update was not stored: %+v", found)
+	}
+	if _, err := repo.FindURLByDestination(ctx, owner, created.Domain, update.DestinationHash); err != nil {
+		t.Errorf("Expected link under its new destination hash, got %v", err)
+	}
+}
+
+func testDeleteURL(t *testing.T, repo interfaces.URLRepository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, newURL(t, "", "owner-"+unique(t)))
+
+	if err := repo.DeleteURL(ctx, created.Domain, created.ShortCode); err != nil {
+		t.Fatalf("DeleteURL failed: %v", err)
+	}
+	if _, err := repo.GetURLByShortCode(ctx, created.Domain, created.ShortCode); !errors.Is(err, interfaces.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if _, total, err := repo.ListURLsByOwner(ctx, created.OwnerID, 10, 0); err != nil || total != 0 {
+		t.Errorf("Expected deleted link to leave the owner's list, got total %d (%v)", total, err)
+	}
+
+	// The code can be reused once the link is gone
+	mustCreate(t, repo, &models.URL{OriginalURL: "https://example.org", ShortCode: created.ShortCode, RedirectType: 302})
+}
+
+func testListURLsByOwner(t *testing.T, repo interfaces.URLRepository) {
+	ctx := context.Background()
+	owner := "owner-" + unique(t)
+
+	var created []*models.URL
+	for i := 0; i < 5; i++ {
+		domain := ""
+		if i%2 == 1 {
+			domain = testDomain
+		}
+		created = append(created, mustCreate(t, repo, newURL(t, domain, owner)))
+	}
+	mustCreate(t, repo, newURL(t, "", "owner-"+unique(t)))
+
+	page, total, err := repo.ListURLsByOwner(ctx, owner, 2, 0)
+	if err != nil {
+		t.Fatalf("ListURLsByOwner failed: %v", err)
+	}
+	if total != len(created) {
+		t.Errorf("Expected total %d, got %d", len(created), total)
+	}
+	if len(page) != 2 || page[0].ShortCode != created[4].ShortCode || page[1].ShortCode != created[3].ShortCode {
+		t.Errorf("Expected the two newest links first, got %v", codes(page))
+	}
+
+	page, _, err = repo.ListURLsByOwner(ctx, owner, 2, 4)
+	if err != nil {
+		t.Fatalf("ListURLsByOwner failed: %v", err)
+	}
+	if len(page) != 1 || page[0].ShortCode != created[0].ShortCode {
+		t.Errorf("Expected the oldest link on the last page, got %v", codes(page))
+	}
+
+	page, total, err = repo.ListURLsByOwner(ctx, "owner-"+unique(t), 10, 0)
+	if err != nil || total != 0 || page == nil || len(page) != 0 {
+		t.Errorf("Expected an empty, non-nil list for an unknown owner, got %v, %d, %v", page, total, err)
+	}
+}
+
+func codes(urls []*models.URL) []string {
+	out := make([]string, len(urls))
+	for i, url := range urls {
+		out[i] = url.ShortCode
+	}
+	return out
+}
+
+func testFindURLByDestination(t *testing.T, repo interfaces.URLRepository) {
+	ctx := context.Background()
+	owner := "owner-" + unique(t)
+	hash := unique(t)
+	withHash := func(url *models.URL) *models.URL {
+		url.DestinationHash = hash
+		return url
+	}
+
+	past := time.Now().Add(-time.Hour)
+	expired := withHash(newURL(t, testDomain, owner))
+	expired.ExpiresAt = &past
+	mustCreate(t, repo, expired)
+	oldest := mustCreate(t, repo, withHash(newURL(t, testDomain, owner)))
+	mustCreate(t, repo, withHash(newURL(t, testDomain, owner)))
+	mustCreate(t, repo, withHash(newURL(t, "", owner)))
+	mustCreate(t, repo, withHash(newURL(t, testDomain, "owner-"+unique(t))))
+
+	found, err := repo.FindURLByDestination(ctx, owner, testDomain, hash)
+	if err != nil {
+		t.Fatalf("FindURLByDestination failed: %v", err)
+	}
+	if found.ShortCode != oldest.ShortCode {
+		t.Errorf("Expected the oldest unexpired link %s, got %s", oldest.ShortCode, found.ShortCode)
+	}
+
+	if _, err := repo.FindURLByDestination(ctx, "owner-"+unique(t), testDomain, hash); !errors.Is(err, interfaces.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for another owner, got %v", err)
+	}
+}
+
+func testConcurrentCreatesSameCode(t *testing.T, repo interfaces.URLRepository) {
+	code := "c" + unique(t)
+
+	var wg sync.WaitGroup
+	errs := make([]error, concurrentCreates)
+	for i := 0; i < concurrentCreates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			url := newURL(t, "", "")
+			url.ShortCode = code
+			_, errs[i] = repo.CreateURL(context.Background(), url)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, interfaces.ErrConflict):
+			t.Errorf("Expected ErrConflict for losing creates, got %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("Expected exactly one create to win, got %d", succeeded)
+	}
+}
+
+func testConcurrentCreatesDistinctCodes(t *testing.T, repo interfaces.URLRepository) {
+	owner := "owner-" + unique(t)
+
+	var wg sync.WaitGroup
+	ids := make([]int, concurrentCreates)
+	for i := 0; i < concurrentCreates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			created, err := repo.CreateURL(context.Background(), newURL(t, "", owner))
+			if err != nil {
+				t.Errorf("CreateURL failed: %v", err)
+				return
+			}
+			ids[i] = created.ID
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool, concurrentCreates)
+	for _, id := range ids {
+		if id != 0 && seen[id] {
+			t.Errorf("ID %d assigned twice", id)
+		}
+		seen[id] = true
+	}
+	if _, total, err := repo.ListURLsByOwner(context.Background(), owner, concurrentCreates, 0); err != nil || total != concurrentCreates {
+		t.Errorf("Expected %d links, got %d (%v)", concurrentCreates, total, err)
+	}
+}
+
+func testCanceledContext(t *testing.T, repo interfaces.URLRepository) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	url := newURL(t, "", "")
+	if _, err := repo.CreateURL(ctx, url); err == nil {
+		t.Error("Expected CreateURL to fail with a canceled context")
+	}
+	if _, err := repo.GetURLByShortCode(ctx, url.Domain, url.ShortCode); err == nil || errors.Is(err, interfaces.ErrNotFound) {
+		t.Errorf("Expected GetURLByShortCode to report cancellation, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// UsageFactory returns the API key and usage repositories under test, which
+// must share storage. It is called once per subtest.
+type UsageFactory func(t *testing.T) (interfaces.APIKeyRepository, interfaces.UsageRepository)
+
+// TestUsageRepository runs the plan and quota conformance suite against the
+// repositories returned by newRepos. The backend must know the free, pro and
+// unlimited plans seeded by the migrations.
+func TestUsageRepository(t *testing.T, newRepos UsageFactory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, keys interfaces.APIKeyRepository, usage interfaces.UsageRepository)
+	}{
+		{"Plans", testPlans},
+		{"ReserveWithinQuota", testReserveWithinQuota},
+		{"ReleaseLinks", testReleaseLinks},
+		{"KeysAreIndependent", testKeysAreIndependent},
+		{"ConcurrentReservations", testConcurrentReservations},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, usage := newRepos(t)
+			tt.fn(t, keys, usage)
+		})
+	}
+}
+
+// usageDay is a fixed time mid-month, so adding a day stays in the month.
+var usageDay = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// newKey creates a key on the unlimited plan and gives it quota, which
+// ReserveLinks enforces as if it came from the key's plan.
+func newKey(t *testing.T, keys interfaces.APIKeyRepository, quota models.Quota) *models.APIKey {
+	t.Helper()
+	key, err := keys.CreateAPIKey(context.Background(), &models.APIKey{
+		OwnerID: "owner-" + unique(t),
+		KeyHash: "hash-" + unique(t),
+		Plan:    "unlimited",
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	key.Quota = quota
+	return key
+}
+
+func assertCounts(t *testing.T, usage interfaces.UsageRepository, keyID int, now time.Time, wantDay, wantMonth int) {
+	t.Helper()
+	day, month, err := usage.CountLinks(context.Background(), keyID, now)
+	if err != nil {
+		t.Fatalf("CountLinks failed: %v", err)
+	}
+	if day != wantDay || month != wantMonth {
+		t.Errorf("Expected %d links today and %d this month, got %d and %d", wantDay, wantMonth, day, month)
+	}
+}
+
+func assertQuotaExceeded(t *testing.T, err error, period string, limit, used int) {
+	t.Helper()
+	var quotaErr *interfaces.QuotaExceededError
+	if !errors.As(err, &quotaErr) || !errors.Is(err, interfaces.ErrQuotaExceeded) {
+		t.Fatalf("Expected QuotaExceededError, got %v", err)
+	}
+	if quotaErr.Period != period || quotaErr.Limit != limit || quotaErr.Used != used {
+		t.Errorf("Expected %d of %d links per %s used, got %+v", used, limit, period, quotaErr)
+	}
+}
+
+func testPlans(t *testing.T, keys interfaces.APIKeyRepository, _ interfaces.UsageRepository) {
+	ctx := context.Background()
+
+	hash := "hash-" + unique(t)
+	created, err := keys.CreateAPIKey(ctx, &models.APIKey{OwnerID: "owner-" + unique(t), KeyHash: hash, Plan: "pro"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if created.Plan != "pro" || created.Quota.LinksPerDay == 0 || created.Quota.RequestsPerMinute == 0 {
+		t.Errorf("Expected the pro plan's quota on the created key, got %+v", created)
+	}
+
+	found, err := keys.GetAPIKeyByHash(ctx, hash)
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash failed: %v", err)
+	}
+	if found.Plan != created.Plan || found.Quota != created.Quota {
+		t.Errorf("Expected plan %s with %+v, got %s with %+v", created.Plan, created.Quota, found.Plan, found.Quota)
+	}
+
+	defaulted, err := keys.CreateAPIKey(ctx, &models.APIKey{OwnerID: "owner-" + unique(t), KeyHash: "hash-" + unique(t)})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if defaulted.Plan != models.DefaultPlan {
+		t.Errorf("Expected plan %s by default, got %s", models.DefaultPlan, defaulted.Plan)
+	}
+
+	_, err = keys.CreateAPIKey(ctx, &models.APIKey{OwnerID: "owner-" + unique(t), KeyHash: "hash-" + unique(t), Plan: "no-such-plan"})
+	if !errors.Is(err, interfaces.ErrUnknownPlan) {
+		t.Errorf("Expected ErrUnknownPlan, got %v", err)
+	}
+}
+
+func testReserveWithinQuota(t *testing.T, keys interfaces.APIKeyRepository, usage interfaces.UsageRepository) {
+	ctx := context.Background()
+	key := newKey(t, keys, models.Quota{LinksPerDay: 3, LinksPerMonth: 5})
+
+	if err := usage.ReserveLinks(ctx, key, 2, usageDay); err != nil {
+		t.Fatalf("ReserveLinks failed: %v", err)
+	}
+	assertQuotaExceeded(t, usage.ReserveLinks(ctx, key, 2, usageDay), interfaces.QuotaPeriodDay, 3, 2)
+	assertCounts(t, usage, key.ID, usageDay, 2, 2)
+
+	if err := usage.ReserveLinks(ctx, key, 1, usageDay); err != nil {
+		t.Fatalf("ReserveLinks failed: %v", err)
+	}
+
+	nextDay := usageDay.Add(24 * time.Hour)
+	if err := usage.ReserveLinks(ctx, key, 2, nextDay); err != nil {
+		t.Fatalf("ReserveLinks on the next day failed: %v", err)
+	}
+	assertQuotaExceeded(t, usage.ReserveLinks(ctx, key, 1, nextDay), interfaces.QuotaPeriodMonth, 5, 5)
+	assertCounts(t, usage, key.ID, nextDay, 2, 5)
+
+	nextMonth := usageDay.AddDate(0, 1, 0)
+	if err := usage.ReserveLinks(ctx, key, 3, nextMonth); err != nil {
+		t.Fatalf("ReserveLinks in the next month failed: %v", err)
+	}
+	assertCounts(t, usage, key.ID, nextMonth, 3, 3)
+
+	unlimited := newKey(t, keys, models.Quota{})
+	if err := usage.ReserveLinks(ctx, unlimited, 1000, usageDay); err != nil {
+		t.Fatalf("ReserveLinks without a quota failed: %v", err)
+	}
+	assertCounts(t, usage, unlimited.ID, usageDay, 1000, 1000)
+}
+
+func testReleaseLinks(t *testing.T, keys interfaces.APIKeyRepository, usage interfaces.UsageRepository) {
+	ctx := context.Background()
+	key := newKey(t, keys, models.Quota{LinksPerDay: 3})
+
+	if err := usage.ReserveLinks(ctx, key, 3, usageDay); err != nil {
+		t.Fatalf("ReserveLinks failed: %v", err)
+	}
+	if err := usage.ReleaseLinks(ctx, key.ID, 2, usageDay); err != nil {
+		t.Fatalf("ReleaseLinks failed: %v", err)
+	}
+	assertCounts(t, usage, key.ID, usageDay, 1, 1)
+
+	if err := usage.ReserveLinks(ctx, key, 2, usageDay); err != nil {
+		t.Errorf("Expected released links to be reservable again, got %v", err)
+	}
+
+	if err := usage.ReleaseLinks(ctx, key.ID, 10, usageDay); err != nil {
+		t.Fatalf("ReleaseLinks failed: %v", err)
+	}
+	assertCounts(t, usage, key.ID, usageDay, 0, 0)
+
+	if err := usage.ReleaseLinks(ctx, key.ID, 1, usageDay.Add(24*time.Hour)); err != nil {
+		t.Errorf("Expected releasing on a day without usage to succeed, got %v", err)
+	}
+}
+
+func testKeysAreIndependent(t *testing.T, keys interfaces.APIKeyRepository, usage interfaces.UsageRepository) {
+	ctx := context.Background()
+	quota := models.Quota{LinksPerDay: 1}
+	first, second := newKey(t, keys, quota), newKey(t, keys, quota)
+
+	if err := usage.ReserveLinks(ctx, first, 1, usageDay); err != nil {
+		t.Fatalf("ReserveLinks failed: %v", err)
+	}
+	if err := usage.ReserveLinks(ctx, second, 1, usageDay); err != nil {
+		t.Errorf("Expected another key's usage not to count, got %v", err)
+	}
+	assertCounts(t, usage, first.ID, usageDay, 1, 1)
+}
+
+func testConcurrentReservations(t *testing.T, keys interfaces.APIKeyRepository, usage interfaces.UsageRepository) {
+	const limit = concurrentCreates / 2
+	key := newKey(t, keys, models.Quota{LinksPerDay: limit})
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+	)
+	for i := 0; i < concurrentCreates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := usage.ReserveLinks(context.Background(), key, 1, usageDay)
+			switch {
+			case err == nil:
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			case !errors.Is(err, interfaces.ErrQuotaExceeded):
+				t.Errorf("ReserveLinks failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved != limit {
+		t.Errorf("Expected %d of %d concurrent reservations to succeed, got %d", limit, concurrentCreates, reserved)
+	}
+	assertCounts(t, usage, key.ID, usageDay, limit, limit)
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// sequenceBlockSize is how many sequence values are fetched per round trip.
+const sequenceBlockSize = 100
+
+// SequenceCounter hands out values of the short_code_seq sequence. Values
+// are fetched in blocks and kept in memory, so each instance uses its own
+// slice of the sequence and values lost on restart are simply skipped.
+type SequenceCounter struct {
+	db *PostgresDB
+
+	mu     sync.Mutex
+	values []uint64
+}
+
+func NewSequenceCounter(db *PostgresDB) *SequenceCounter {
+	return &SequenceCounter{db: db}
+}
+
+func (c *SequenceCounter) Next(ctx context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.values) == 0 {
+		if err := c.fill(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	n := c.values[0]
+	c.values = c.values[1:]
+	return n, nil
+}
+
+func (c *SequenceCounter) fill(ctx context.Context) error {
+	ctx, cancel := c.db.readContext(ctx)
+	defer cancel()
+
+	rows, err := c.db.db.QueryContext(ctx,
+		`SELECT nextval('short_code_seq') FROM generate_series(1, $1)`, sequenceBlockSize)
+	if err != nil {
+		return fmt.Errorf("failed to reserve sequence values: %w", err)
+	}
+	defer rows.Close()
+
+	values := make([]uint64, 0, sequenceBlockSize)
+	for rows.Next() {
+		var n uint64
+		if err := rows.Scan(&n); err != nil {
+			return fmt.Errorf("failed to scan sequence value: %w", err)
+		}
+		values = append(values, n)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to reserve sequence values: %w", err)
+	}
+
+	c.values = values
+	return nil
+}
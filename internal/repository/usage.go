@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// DefaultPlans are the plans seeded by the migrations. The memory and bolt
+// backends, which have no plans table, resolve keys' plans from these.
+var DefaultPlans = map[string]models.Quota{
+	"free":      {RequestsPerMinute: 60, LinksPerDay: 100, LinksPerMonth: 1000},
+	"pro":       {RequestsPerMinute: 600, LinksPerDay: 10000, LinksPerMonth: 200000},
+	"unlimited": {},
+}
+
+// planOrDefault returns the plan a new key is created on.
+func planOrDefault(plan string) string {
+	if plan == "" {
+		return models.DefaultPlan
+	}
+	return plan
+}
+
+// usageDay and usageMonth return the UTC day and month now falls in, as
+// stored and summed by the usage repositories.
+func usageDay(now time.Time) string {
+	return now.UTC().Format("2006-01-02")
+}
+
+func usageMonth(now time.Time) string {
+	return now.UTC().Format("2006-01")
+}
+
+// checkQuota reports whether n more links fit the quota given the links
+// already counted on now's day and in its month.
+func checkQuota(q models.Quota, day, month, n int, now time.Time) error {
+	dayResetsAt, monthResetsAt := models.QuotaResets(now)
+	if q.LinksPerDay > 0 && day+n > q.LinksPerDay {
+		return &interfaces.QuotaExceededError{Period: interfaces.QuotaPeriodDay, Limit: q.LinksPerDay, Used: day, ResetsAt: dayResetsAt}
+	}
+	if q.LinksPerMonth > 0 && month+n > q.LinksPerMonth {
+		return &interfaces.QuotaExceededError{Period: interfaces.QuotaPeriodMonth, Limit: q.LinksPerMonth, Used: month, ResetsAt: monthResetsAt}
+	}
+	return nil
+}
+
+type UsageRepository struct {
+	db *PostgresDB
+}
+
+func NewUsageRepository(db *PostgresDB) *UsageRepository {
+	return &UsageRepository{db: db}
+}
+
+// ReserveLinks locks the key's row so concurrent reservations for the same
+// key, on any instance, are checked one after another.
+func (r *UsageRepository) ReserveLinks(ctx context.Context, key *models.APIKey, n int, now time.Time) error {
+	ctx, cancel := r.db.writeContext(ctx)
+	defer cancel()
+
+	tx, err := r.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM api_keys WHERE id = $1 FOR UPDATE`, key.ID); err != nil {
+		return fmt.Errorf("failed to lock API key: %w", err)
+	}
+
+	day, month, err := countLinks(ctx, tx, key.ID, now)
+	if err != nil {
+		return err
+	}
+	if err := checkQuota(key.Quota, day, month, n, now); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO api_key_usage (api_key_id, day, links_created)
+		VALUES ($1, $2::date, $3)
+		ON CONFLICT (api_key_id, day)
+		DO UPDATE SET links_created = api_key_usage.links_created + EXCLUDED.links_created`
+
+	if _, err := tx.ExecContext(ctx, query, key.ID, usageDay(now), n); err != nil {
+		return fmt.Errorf("failed to count links: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit usage: %w", err)
+	}
+
+	return nil
+}
+
+func (r *UsageRepository) ReleaseLinks(ctx context.Context, keyID, n int, now time.Time) error {
+	ctx, cancel := r.db.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE api_key_usage SET links_created = GREATEST(links_created - $3, 0)
+		WHERE api_key_id = $1 AND day = $2::date`
+
+	if _, err := r.db.db.ExecContext(ctx, query, keyID, usageDay(now), n); err != nil {
+		return fmt.Errorf("failed to release links: %w", err)
+	}
+
+	return nil
+}
+
+func (r *UsageRepository) CountLinks(ctx context.Context, keyID int, now time.Time) (int, int, error) {
+	ctx, cancel := r.db.readContext(ctx)
+	defer cancel()
+
+	return countLinks(ctx, r.db.db, keyID, now)
+}
+
+// queryRower is implemented by *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func countLinks(ctx context.Context, q queryRower, keyID int, now time.Time) (int, int, error) {
+	query := `
+		SELECT
+			COALESCE(SUM(links_created) FILTER (WHERE day = $2::date), 0),
+			COALESCE(SUM(links_created), 0)
+		FROM api_key_usage
+		WHERE api_key_id = $1 AND day BETWEEN date_trunc('month', $2::date)::date AND $2::date`
+
+	var day, month int
+	if err := q.QueryRowContext(ctx, query, keyID, usageDay(now)).Scan(&day, &month); err != nil {
+		return 0, 0, fmt.Errorf("failed to count links: %w", err)
+	}
+
+	return day, month, nil
+}
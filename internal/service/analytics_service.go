@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/config"
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+const (
+	clickBufferSize     = 10000
+	clickBatchSize      = 500
+	clickFlushInterval  = 2 * time.Second
+	statsWindowDays     = 30
+	statsTopReferrers   = 10
+	ipv4AnonymizeBits   = 24
+	ipv6AnonymizeBits   = 48
+	ipv4AddressBitCount = 32
+	ipv6AddressBitCount = 128
+)
+
+// AnalyticsService records click events off the request path. RecordClick
+// only enqueues; a background worker writes events to the ClickRepository in
+// batches so redirects never wait on the database.
+type AnalyticsService struct {
+	clicks  interfaces.ClickRepository
+	urlRepo interfaces.URLRepository
+	domains *domainSet
+
+	events chan models.ClickEvent
+	done   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+
+	// mu keeps RecordClick from queueing events once Close has started,
+	// since the worker would never write them.
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewAnalyticsService(clicks interfaces.ClickRepository, urlRepo interfaces.URLRepository, cfg *config.Config) *AnalyticsService {
+	s := &AnalyticsService{
+		clicks:  clicks,
+		urlRepo: urlRepo,
+		domains: newDomainSet(cfg.BaseURL, cfg.ShortDomains),
+		events:  make(chan models.ClickEvent, clickBufferSize),
+		done:    make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+// RecordClick queues a click event. The client IP is anonymized and the
+// request host mapped to its short domain before it is queued. If the buffer
+// is full, or the service has been closed, the event is dropped rather than
+// blocking the caller.
+func (s *AnalyticsService) RecordClick(event models.ClickEvent) {
+	if event.ClickedAt.IsZero() {
+		event.ClickedAt = time.Now()
+	}
+	if event.Host != "" {
+		event.Domain = s.domains.forHost(event.Host)
+	}
+	event.IPAddress = AnonymizeIP(event.IPAddress)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		log.Printf("Warning: analytics closed, dropping event for %s", event.ShortCode)
+		return
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		log.Printf("Warning: click buffer full, dropping event for %s", event.ShortCode)
+	}
+}
+
+// GetLinkStats returns click statistics for a link owned by ownerID. Links
+// owned by someone else are reported as not found.
+func (s *AnalyticsService) GetLinkStats(ctx context.Context, ownerID, domain, shortCode string) (*models.LinkStats, error) {
+	domain, err := s.domains.canonical(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := s.urlRepo.GetURLByShortCode(ctx, domain, shortCode)
+	if errors.Is(err, interfaces.ErrNotFound) {
+		return nil, interfaces.ErrLinkNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up short code: %w", err)
+	}
+	if url.OwnerID != ownerID {
+		return nil, interfaces.ErrLinkNotFound
+	}
+
+	stats, err := s.clicks.GetLinkStats(ctx, domain, shortCode, statsWindowDays, statsTopReferrers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// Close stops the background worker after flushing any queued events.
+func (s *AnalyticsService) Close() {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+
+		close(s.done)
+		s.wg.Wait()
+	})
+}
+
+func (s *AnalyticsService) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(clickFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.ClickEvent, 0, clickBatchSize)
+	for {
+		select {
+		case event := <-s.events:
+			batch = append(batch, event)
+			if len(batch) >= clickBatchSize {
+				batch = s.flush(batch)
+			}
+		case <-ticker.C:
+			batch = s.flush(batch)
+		case <-s.done:
+			// Drain whatever is still buffered before exiting
+			for {
+				select {
+				case event := <-s.events:
+					batch = append(batch, event)
+					if len(batch) >= clickBatchSize {
+						batch = s.flush(batch)
+					}
+				default:
+					s.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *AnalyticsService) flush(batch []models.ClickEvent) []models.ClickEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := s.clicks.InsertClicks(context.Background(), batch); err != nil {
+		log.Printf("Warning: failed to write %d click events: %v", len(batch), err)
+	}
+	return batch[:0]
+}
+
+// AnonymizeIP zeroes the host portion of an IP address: the last octet of an
+// IPv4 address and everything past the /48 prefix of an IPv6 address.
+// Unparseable input yields an empty string.
+func AnonymizeIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(ipv4AnonymizeBits, ipv4AddressBitCount)).String()
+	}
+	return parsed.Mask(net.CIDRMask(ipv6AnonymizeBits, ipv6AddressBitCount)).String()
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// Mock click repository for testing
+type mockClickRepository struct {
+	mu      sync.Mutex
+	batches [][]models.ClickEvent
+}
+
+func (m *mockClickRepository) InsertClicks(ctx context.Context, events []models.ClickEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	batch := make([]models.ClickEvent, len(events))
+	copy(batch, events)
+	m.batches = append(m.batches, batch)
+	return nil
+}
+
+func (m *mockClickRepository) GetLinkStats(ctx context.Context, domain, shortCode string, days, topReferrers int) (*models.LinkStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := &models.LinkStats{ShortCode: shortCode}
+	for _, batch := range m.batches {
+		for _, e := range batch {
+			if e.Domain == domain && e.ShortCode == shortCode {
+				stats.TotalClicks++
+			}
+		}
+	}
+	return stats, nil
+}
+
+func TestAnalyticsService_RecordClick(t *testing.T) {
+	clicks := &mockClickRepository{}
+	urlRepo := newMockURLRepository()
+	urlRepo.urls["abc"] = &models.URL{ShortCode: "abc", OwnerID: "team-a"}
+	urlRepo.shortCodes["abc"] = true
+	service := NewAnalyticsService(clicks, urlRepo, testConfig())
+
+	for i := 0; i < 3; i++ {
+		service.RecordClick(models.ClickEvent{ShortCode: "abc", Host: "sho.rt", IPAddress: "203.0.113.42"})
+	}
+	service.Close()
+
+	var events []models.ClickEvent
+	for _, batch := range clicks.batches {
+		events = append(events, batch...)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events written, got %d", len(events))
+	}
+	if events[0].IPAddress != "203.0.113.0" {
+		t.Errorf("Expected anonymized IP 203.0.113.0, got %s", events[0].IPAddress)
+	}
+	if events[0].ClickedAt.IsZero() {
+		t.Error("Expected click timestamp to be set")
+	}
+
+	stats, err := service.GetLinkStats(context.Background(), "team-a", "", "abc")
+	if err != nil {
+		t.Fatalf("GetLinkStats failed: %v", err)
+	}
+	if stats.TotalClicks != 3 {
+		t.Errorf("Expected 3 total clicks, got %d", stats.TotalClicks)
+	}
+
+	_, err = service.GetLinkStats(context.Background(), "team-a", "", "missing")
+	if !errors.Is(err, interfaces.ErrLinkNotFound) {
+		t.Errorf("Expected ErrLinkNotFound, got %v", err)
+	}
+
+	_, err = service.GetLinkStats(context.Background(), "team-b", "", "abc")
+	if !errors.Is(err, interfaces.ErrLinkNotFound) {
+		t.Errorf("Expected ErrLinkNotFound for another owner's link, got %v", err)
+	}
+}
+
+func TestAnalyticsService_RecordClickAfterClose(t *testing.T) {
+	clicks := &mockClickRepository{}
+	service := NewAnalyticsService(clicks, newMockURLRepository(), testConfig())
+	service.Close()
+
+	for i := 0; i < 100; i++ {
+		service.RecordClick(models.ClickEvent{ShortCode: "abc", IPAddress: "203.0.113.42"})
+	}
+	if n := len(service.events); n != 0 {
+		t.Errorf("Expected no events queued after Close, got %d", n)
+	}
+	if len(clicks.batches) != 0 {
+		t.Errorf("Expected nothing written after Close, got %d batches", len(clicks.batches))
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := map[string]string{
+		"192.168.1.77":          "192.168.1.0",
+		"2001:db8:abcd:1234::1": "2001:db8:abcd::",
+		"::ffff:10.1.2.3":       "10.1.2.0",
+		"not-an-ip":             "",
+		"":                      "",
+	}
+
+	for input, want := range tests {
+		if got := AnonymizeIP(input); got != want {
+			t.Errorf("AnonymizeIP(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
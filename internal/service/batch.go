@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// maxBatchCodeAttempts bounds how many insert rounds are spent replacing
+// generated codes that collided with existing links.
+const maxBatchCodeAttempts = 3
+
+// ShortenURLs creates many links at once. Each item is validated on its own,
+// with the same checks as ShortenURL, before anything is written and gets
+// its own result; invalid items and taken aliases are reported
+// per item without failing the rest of the batch. Items asking for dedupe
+// also reuse links created earlier in the same batch. An error is only
+// returned when the batch as a whole could not be written.
+func (s *URLService) ShortenURLs(ctx context.Context, req *models.BatchShortenRequest) ([]models.BatchShortenResult, error) {
+	now := time.Now()
+	results := make([]models.BatchShortenResult, len(req.Items))
+
+	pending := make(map[int]*models.URL, len(req.Items))
+	generated := make(map[int]bool)
+	aliases := make(map[string]bool)    // keyed by domain + "/" + alias
+	dedupeFirst := make(map[string]int) // keyed by domain + "/" + destination hash
+	dedupeOf := make(map[int]int)       // later duplicate -> first item
+	for i := range req.Items {
+		results[i].Index = i
+
+		item := req.Items[i]
+		item.OwnerID = req.OwnerID
+		url, err := s.prepareURL(ctx, &item, now)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		existing, err := s.existingURL(ctx, &item, url)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			results[i].ShortenResponse = s.dedupeResponse(existing)
+			continue
+		}
+		if item.Dedupe && url.ShortCode == "" {
+			key := url.Domain + "/" + url.DestinationHash
+			if first, ok := dedupeFirst[key]; ok {
+				dedupeOf[i] = first
+				continue
+			}
+			dedupeFirst[key] = i
+		}
+
+		if url.ShortCode == "" {
+			generated[i] = true
+		} else {
+			key := url.Domain + "/" + url.ShortCode
+			if aliases[key] {
+				results[i].Err = interfaces.ErrAliasTaken
+				continue
+			}
+			aliases[key] = true
+		}
+		pending[i] = url
+	}
+
+	var created []*models.URL
+	for attempt := 0; len(pending) > 0 && attempt < maxBatchCodeAttempts; attempt++ {
+		batch, byCode, err := s.assignBatchCodes(ctx, pending, generated)
+		if err != nil {
+			return nil, err
+		}
+
+		inserted, err := s.repo.CreateURLs(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create URLs: %w", err)
+		}
+		for _, url := range inserted {
+			i := byCode[url.Domain+"/"+url.ShortCode]
+			results[i].ShortenResponse = s.shortenResponse(url)
+			delete(pending, i)
+		}
+		created = append(created, inserted...)
+
+		// Aliases that were not inserted already belong to another link;
+		// generated codes get a fresh value on the next round.
+		for i := range pending {
+			if !generated[i] {
+				results[i].Err = interfaces.ErrAliasTaken
+				delete(pending, i)
+			}
+		}
+	}
+	for i, url := range pending {
+		results[i].Err = &interfaces.KeyspaceExhaustedError{Domain: url.Domain, Attempts: maxBatchCodeAttempts}
+	}
+	for i, first := range dedupeOf {
+		results[i].Err = results[first].Err
+		if results[first].ShortenResponse != nil {
+			response := *results[first].ShortenResponse
+			response.Deduplicated = true
+			results[i].ShortenResponse = &response
+		}
+	}
+
+	s.cacheURLs(ctx, created)
+
+	return results, nil
+}
+
+// assignBatchCodes gives every pending item needing a generated code a fresh
+// random one, and returns the rows to insert along with a lookup from
+// domain + "/" + short code to item index. Aliases are placed first so a
+// generated code never displaces one.
+func (s *URLService) assignBatchCodes(ctx context.Context, pending map[int]*models.URL, generated map[int]bool) ([]*models.URL, map[string]int, error) {
+	indexes := make([]int, 0, len(pending))
+	for i := range pending {
+		indexes = append(indexes, i)
+	}
+	sort.Slice(indexes, func(a, b int) bool {
+		ia, ib := indexes[a], indexes[b]
+		if generated[ia] != generated[ib] {
+			return !generated[ia]
+		}
+		return ia < ib
+	})
+
+	batch := make([]*models.URL, 0, len(indexes))
+	byCode := make(map[string]int, len(indexes))
+	for _, i := range indexes {
+		url := pending[i]
+		if generated[i] {
+			for {
+				code, err := s.codes.Generate(ctx)
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to generate short code: %w", err)
+				}
+				if _, dup := byCode[url.Domain+"/"+code]; !dup {
+					url.ShortCode = code
+					break
+				}
+			}
+		}
+		byCode[url.Domain+"/"+url.ShortCode] = i
+		batch = append(batch, url)
+	}
+
+	return batch, byCode, nil
+}
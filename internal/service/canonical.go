@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strings"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"golang.org/x/net/idna"
+)
+
+// defaultPorts are dropped from canonical URLs.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// canonicalizer rewrites destinations into a canonical form so equivalent
+// URLs compare equal for dedupe and blocklist matching. The raw URL is still
+// what links redirect to.
+type canonicalizer struct {
+	// trackingParams are query parameters dropped from canonical URLs.
+	// Entries ending in '*' match by prefix, e.g. "utm_*".
+	trackingParams   map[string]bool
+	trackingPrefixes []string
+}
+
+func newCanonicalizer(trackingParams []string) *canonicalizer {
+	c := &canonicalizer{trackingParams: make(map[string]bool, len(trackingParams))}
+	for _, param := range trackingParams {
+		param = strings.ToLower(param)
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			c.trackingPrefixes = append(c.trackingPrefixes, prefix)
+			continue
+		}
+		c.trackingParams[param] = true
+	}
+	return c
+}
+
+// canonicalize returns the canonical form of u: lowercase scheme and host,
+// IDN hosts in punycode, no default port, dot segments resolved and the
+// query sorted with tracking parameters removed. u is not modified.
+func (c *canonicalizer) canonicalize(u *neturl.URL) (*neturl.URL, error) {
+	canonical := *u
+	canonical.Scheme = strings.ToLower(u.Scheme)
+
+	if u.Opaque != "" || u.Host == "" {
+		return &canonical, nil
+	}
+
+	host, err := canonicalHost(u.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid host: %v", interfaces.ErrInvalidURL, err)
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[canonical.Scheme] {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	canonical.Host = host
+
+	// Resolving against an empty reference removes "." and ".." segments
+	// while keeping the query and fragment
+	canonical = *canonical.ResolveReference(&neturl.URL{})
+	if canonical.Path == "" {
+		canonical.Path = "/"
+		canonical.RawPath = ""
+	}
+
+	if u.RawQuery != "" {
+		canonical.RawQuery = c.canonicalQuery(u.Query())
+	}
+
+	return &canonical, nil
+}
+
+// canonicalHost lowercases host and converts internationalized names to
+// punycode. IP literals are returned in their standard form.
+func canonicalHost(host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	return idna.Lookup.ToASCII(strings.ToLower(host))
+}
+
+// canonicalQuery drops tracking parameters and encodes the rest sorted by
+// key. Values of a repeated key keep their order.
+func (c *canonicalizer) canonicalQuery(query neturl.Values) string {
+	for key := range query {
+		if c.isTrackingParam(key) {
+			delete(query, key)
+		}
+	}
+	return query.Encode()
+}
+
+func (c *canonicalizer) isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	if c.trackingParams[key] {
+		return true
+	}
+	for _, prefix := range c.trackingPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
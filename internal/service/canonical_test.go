@@ -0,0 +1,56 @@
+package service
+
+import (
+	"errors"
+	neturl "net/url"
+	"testing"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+)
+
+func TestCanonicalizer(t *testing.T) {
+	c := newCanonicalizer([]string{"utm_*", "fbclid"})
+
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"https://Example.com:443/a/../b?utm_source=x", "https://example.com/b"},
+		{"HTTP://example.com:80", "http://example.com/"},
+		{"http://example.com:8080/x", "http://example.com:8080/x"},
+		{"https://example.com/a/./b/../c/", "https://example.com/a/c/"},
+		{"https://example.com/p?b=2&a=1&fbclid=abc&a=0", "https://example.com/p?a=1&a=0&b=2"},
+		{"https://example.com/p?UTM_Medium=email&q=go", "https://example.com/p?q=go"},
+		{"https://bücher.example/katalog", "https://xn--bcher-kva.example/katalog"},
+		{"https://example.com/page#Section", "https://example.com/page#Section"},
+		{"http://[::1]:80/", "http://[::1]/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			u, err := neturl.Parse(tt.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := c.canonicalize(u)
+			if err != nil {
+				t.Fatalf("canonicalize failed: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+			if u.String() == tt.want && tt.raw != tt.want {
+				t.Error("Expected the input URL to be left unchanged")
+			}
+		})
+	}
+}
+
+func TestCanonicalizer_InvalidHost(t *testing.T) {
+	u := &neturl.URL{Scheme: "https", Host: "exa mple.com", Path: "/"}
+
+	if _, err := newCanonicalizer(nil).canonicalize(u); !errors.Is(err, interfaces.ErrInvalidURL) {
+		t.Errorf("Expected ErrInvalidURL, got %v", err)
+	}
+}
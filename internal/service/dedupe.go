@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// destinationHash is the stored digest of a canonical destination.
+func destinationHash(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// existingURL returns the owner's live link to the same destination as url,
+// or nil if deduplication does not apply or finds nothing. Links with an
+// alias or without an owner are never deduplicated.
+func (s *URLService) existingURL(ctx context.Context, req *models.ShortenRequest, url *models.URL) (*models.URL, error) {
+	if !req.Dedupe || url.ShortCode != "" || url.OwnerID == "" {
+		return nil, nil
+	}
+
+	existing, err := s.repo.FindURLByDestination(ctx, url.OwnerID, url.Domain, url.DestinationHash)
+	if errors.Is(err, interfaces.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up existing URL: %w", err)
+	}
+	return existing, nil
+}
+
+// dedupeResponse builds the response for an existing link returned in place
+// of a new one.
+func (s *URLService) dedupeResponse(url *models.URL) *models.ShortenResponse {
+	response := s.shortenResponse(url)
+	response.Deduplicated = true
+	return response
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strings"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+)
+
+// PrimaryDomain is how links on the BASE_URL domain are stored.
+const PrimaryDomain = ""
+
+// domainSet knows which hosts serve short links and how to build short URLs
+// for each of them.
+type domainSet struct {
+	scheme      string
+	baseURL     string
+	primaryHost string
+	extra       map[string]bool
+}
+
+func newDomainSet(baseURL string, extra []string) *domainSet {
+	baseURL = strings.TrimRight(baseURL, "/")
+	d := &domainSet{
+		scheme:  "http",
+		baseURL: baseURL,
+		extra:   make(map[string]bool, len(extra)),
+	}
+	if u, err := neturl.Parse(baseURL); err == nil && u.Host != "" {
+		d.scheme = u.Scheme
+		d.primaryHost = strings.ToLower(u.Host)
+	}
+	for _, host := range extra {
+		d.extra[strings.ToLower(host)] = true
+	}
+	return d
+}
+
+// canonical validates a domain requested by a client and returns the value
+// stored on the link. The primary host and "" both map to PrimaryDomain.
+func (d *domainSet) canonical(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	switch {
+	case domain == "" || domain == d.primaryHost:
+		return PrimaryDomain, nil
+	case d.extra[domain]:
+		return domain, nil
+	default:
+		return "", fmt.Errorf("%w: %q is not a configured short domain", interfaces.ErrInvalidDomain, domain)
+	}
+}
+
+// forHost maps an incoming Host header to the domain whose links it serves.
+// Unknown hosts (IPs, internal names) fall back to the primary domain.
+func (d *domainSet) forHost(host string) string {
+	host = strings.ToLower(host)
+	if d.extra[host] {
+		return host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil && d.extra[h] {
+		return h
+	}
+	return PrimaryDomain
+}
+
+func (d *domainSet) shortURL(domain, shortCode string) string {
+	if domain == PrimaryDomain {
+		return fmt.Sprintf("%s/%s", d.baseURL, shortCode)
+	}
+	return fmt.Sprintf("%s://%s/%s", d.scheme, domain, shortCode)
+}
+
+// isShortHost reports whether host (without port) serves this service's
+// short links.
+func (d *domainSet) isShortHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if d.extra[host] {
+		return true
+	}
+	primary := d.primaryHost
+	if h, _, err := net.SplitHostPort(primary); err == nil {
+		primary = h
+	}
+	return host != "" && host == primary
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// flightGroup coalesces concurrent lookups of the same key into a single
+// call whose result every caller shares, like x/sync/singleflight.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done chan struct{}
+	url  *models.URL
+	err  error
+}
+
+// do runs fn once for all concurrent callers with the same key. Each caller
+// gets its own copy of the link.
+func (g *flightGroup) do(key string, fn func() (*models.URL, error)) (*models.URL, error) {
+	call, started := g.start(key)
+	if started {
+		g.run(key, call, fn)
+	} else {
+		<-call.done
+	}
+
+	if call.url == nil {
+		return nil, call.err
+	}
+	url := *call.url
+	return &url, call.err
+}
+
+// doBackground runs fn in a new goroutine unless a call for key is already
+// in flight.
+func (g *flightGroup) doBackground(key string, fn func() (*models.URL, error)) {
+	if call, started := g.start(key); started {
+		go g.run(key, call, fn)
+	}
+}
+
+// start returns the in-flight call for key, or registers a new one and
+// reports true if there was none.
+func (g *flightGroup) start(key string) (*flightCall, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if call, ok := g.calls[key]; ok {
+		return call, false
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	return call, true
+}
+
+func (g *flightGroup) run(key string, call *flightCall, fn func() (*models.URL, error)) {
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	call.url, call.err = fn()
+}
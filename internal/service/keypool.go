@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+)
+
+const (
+	// keyPoolCheckInterval is how often the pool table is checked for
+	// restocking even when no instance is running low.
+	keyPoolCheckInterval = 30 * time.Second
+	// keyPoolFillChunk is how many codes are generated per insert when
+	// restocking the pool table.
+	keyPoolFillChunk = 1000
+)
+
+// KeyPool hands out pre-generated short codes. Codes are created ahead of
+// time in the pool table by a background worker, leased to this instance in
+// blocks and served from memory, so taking a code costs no query and needs
+// no uniqueness check. KeyPool is itself a CodeGenerator and can be passed to
+// NewURLService.
+type KeyPool struct {
+	store     interfaces.KeyPoolRepository
+	source    interfaces.CodeGenerator
+	blockSize int
+	target    int
+
+	mu     sync.Mutex
+	leased []string
+	// leasing is set while a Generate call leases a block without holding
+	// mu, so other calls fall back to source instead of waiting on it.
+	leasing bool
+
+	refill chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// NewKeyPool starts a pool that leases blockSize codes at a time and keeps
+// at least target codes in the pool table, generating new ones from source.
+func NewKeyPool(store interfaces.KeyPoolRepository, source interfaces.CodeGenerator, blockSize, target int) *KeyPool {
+	p := &KeyPool{
+		store:     store,
+		source:    source,
+		blockSize: blockSize,
+		target:    target,
+		refill:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.run()
+
+	return p
+}
+
+// Generate returns the next leased code. When the in-memory block is empty
+// one caller leases a new block on the spot; callers arriving meanwhile, or
+// finding the pool table empty too, take a code straight from the source
+// generator so creating links never waits on or depends on the pool.
+func (p *KeyPool) Generate(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.leased) == 0 && !p.leasing {
+		p.leasing = true
+		p.mu.Unlock()
+		codes, err := p.store.LeaseCodes(ctx, p.blockSize)
+		p.mu.Lock()
+		p.leasing = false
+
+		if err != nil {
+			log.Printf("Warning: failed to lease short codes: %v", err)
+		}
+		p.leased = append(p.leased, codes...)
+	}
+
+	if len(p.leased) < p.blockSize/4 {
+		p.requestRefill()
+	}
+
+	if len(p.leased) == 0 {
+		return p.source.Generate(ctx)
+	}
+
+	code := p.leased[0]
+	p.leased = p.leased[1:]
+	return code, nil
+}
+
+// Close stops the background worker and returns unused leased codes to the
+// pool table.
+func (p *KeyPool) Close() {
+	p.once.Do(func() {
+		close(p.done)
+		p.wg.Wait()
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if len(p.leased) > 0 {
+			if _, err := p.store.AddCodes(context.Background(), p.leased); err != nil {
+				log.Printf("Warning: failed to return %d leased codes: %v", len(p.leased), err)
+			}
+			p.leased = nil
+		}
+	})
+}
+
+func (p *KeyPool) requestRefill() {
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+}
+
+func (p *KeyPool) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(keyPoolCheckInterval)
+	defer ticker.Stop()
+
+	p.restock()
+	p.topUp()
+	for {
+		select {
+		case <-p.refill:
+			p.topUp()
+			p.restock()
+		case <-ticker.C:
+			p.restock()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// topUp leases another block in the background once the in-memory supply
+// runs low, so Generate rarely has to wait for the database.
+func (p *KeyPool) topUp() {
+	p.mu.Lock()
+	low := len(p.leased) < p.blockSize/4
+	p.mu.Unlock()
+	if !low {
+		return
+	}
+
+	codes, err := p.store.LeaseCodes(context.Background(), p.blockSize)
+	if err != nil {
+		log.Printf("Warning: failed to lease short codes: %v", err)
+		return
+	}
+
+	p.mu.Lock()
+	p.leased = append(p.leased, codes...)
+	p.mu.Unlock()
+}
+
+// restock fills the pool table back up to target once it drops below half.
+func (p *KeyPool) restock() {
+	available, err := p.store.AvailableCodes(context.Background())
+	if err != nil {
+		log.Printf("Warning: failed to count pooled short codes: %v", err)
+		return
+	}
+	if available >= p.target/2 {
+		return
+	}
+
+	for available < p.target {
+		added, err := p.fill(min(keyPoolFillChunk, p.target-available))
+		if err != nil {
+			log.Printf("Warning: failed to restock short codes: %v", err)
+			return
+		}
+		if added == 0 {
+			// Every candidate was already taken; the keyspace is crowded
+			log.Printf("Warning: no new short codes could be pooled")
+			return
+		}
+		available += added
+	}
+}
+
+func (p *KeyPool) fill(n int) (int, error) {
+	ctx := context.Background()
+	codes := make([]string, 0, n)
+	for len(codes) < n {
+		code, err := p.source.Generate(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to generate short code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	return p.store.AddCodes(ctx, codes)
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockKeyPoolRepository is an in-memory pool table.
+type mockKeyPoolRepository struct {
+	mu     sync.Mutex
+	codes  []string
+	leases int
+}
+
+func (m *mockKeyPoolRepository) AddCodes(ctx context.Context, codes []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes = append(m.codes, codes...)
+	return len(codes), nil
+}
+
+func (m *mockKeyPoolRepository) LeaseCodes(ctx context.Context, n int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.leases++
+	if n > len(m.codes) {
+		n = len(m.codes)
+	}
+	leased := m.codes[:n]
+	m.codes = m.codes[n:]
+	return leased, nil
+}
+
+func (m *mockKeyPoolRepository) AvailableCodes(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.codes), nil
+}
+
+func (m *mockKeyPoolRepository) available() int {
+	n, _ := m.AvailableCodes(context.Background())
+	return n
+}
+
+// sequenceGenerator yields c0, c1, c2, ...
+type sequenceGenerator struct {
+	mu   sync.Mutex
+	next int
+}
+
+func (g *sequenceGenerator) Generate(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.next++
+	return fmt.Sprintf("c%d", g.next-1), nil
+}
+
+func TestKeyPool_Generate(t *testing.T) {
+	store := &mockKeyPoolRepository{}
+	for i := 0; i < 100; i++ {
+		store.codes = append(store.codes, fmt.Sprintf("pooled%d", i))
+	}
+	pool := NewKeyPool(store, &sequenceGenerator{}, 40, 100)
+	defer pool.Close()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 30; i++ {
+		code, err := pool.Generate(context.Background())
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		if seen[code] {
+			t.Fatalf("Code %s handed out twice", code)
+		}
+		seen[code] = true
+	}
+
+	store.mu.Lock()
+	leases := store.leases
+	store.mu.Unlock()
+	if leases > 3 {
+		t.Errorf("Expected codes to be served from leased blocks, got %d leases for 30 codes", leases)
+	}
+}
+
+func TestKeyPool_Restock(t *testing.T) {
+	store := &mockKeyPoolRepository{}
+	pool := NewKeyPool(store, &sequenceGenerator{}, 10, 50)
+
+	// The worker leases a block and stocks the table back up in the background
+	if _, err := pool.Generate(context.Background()); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	pool.Close()
+
+	// Unused leased codes are returned on Close; at most the one code handed
+	// out is missing
+	if store.available() < 49 {
+		t.Errorf("Expected pool table to be restocked to 50, got %d", store.available())
+	}
+}
+
+func TestKeyPool_EmptyFallsBackToSource(t *testing.T) {
+	store := &mockKeyPoolRepository{}
+	pool := &KeyPool{store: store, source: &sequenceGenerator{}, blockSize: 10, refill: make(chan struct{}, 1)}
+
+	code, err := pool.Generate(context.Background())
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if code != "c0" {
+		t.Errorf("Expected a code from the source generator, got %s", code)
+	}
+}
+
+// slowKeyPoolRepository holds LeaseCodes until release is closed.
+type slowKeyPoolRepository struct {
+	mockKeyPoolRepository
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (m *slowKeyPoolRepository) LeaseCodes(ctx context.Context, n int) ([]string, error) {
+	m.entered <- struct{}{}
+	<-m.release
+	return m.mockKeyPoolRepository.LeaseCodes(ctx, n)
+}
+
+func TestKeyPool_GenerateDoesNotWaitForLease(t *testing.T) {
+	store := &slowKeyPoolRepository{
+		mockKeyPoolRepository: mockKeyPoolRepository{codes: []string{"a", "b", "c", "d"}},
+		entered:               make(chan struct{}, 1),
+		release:               make(chan struct{}),
+	}
+	pool := &KeyPool{store: store, source: &sequenceGenerator{}, blockSize: 4, refill: make(chan struct{}, 1)}
+
+	leased := make(chan string, 1)
+	go func() {
+		code, _ := pool.Generate(context.Background())
+		leased <- code
+	}()
+	<-store.entered
+
+	// While the lease is in flight, other calls are served by the source
+	var wg sync.WaitGroup
+	codes := make(chan string, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, err := pool.Generate(context.Background())
+			if err != nil {
+				t.Errorf("Generate failed: %v", err)
+			}
+			codes <- code
+		}()
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		close(store.release)
+		t.Fatal("Generate waited for the lease in flight")
+	}
+	close(codes)
+	for code := range codes {
+		if code[0] != 'c' {
+			t.Errorf("Expected a code from the source generator, got %s", code)
+		}
+	}
+
+	close(store.release)
+	if code := <-leased; code != "a" {
+		t.Errorf("Expected the leasing call to get a pooled code, got %s", code)
+	}
+}
+
+func TestKeyPool_CloseReturnsLeasedCodes(t *testing.T) {
+	store := &mockKeyPoolRepository{codes: []string{"a", "b", "c", "d"}}
+	pool := &KeyPool{store: store, source: &sequenceGenerator{}, blockSize: 4, refill: make(chan struct{}, 1), done: make(chan struct{})}
+
+	if _, err := pool.Generate(context.Background()); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	pool.Close()
+
+	if store.available() != 3 {
+		t.Errorf("Expected 3 unused codes back in the pool, got %d", store.available())
+	}
+}
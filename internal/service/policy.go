@@ -0,0 +1,300 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+)
+
+// Names of the built-in URL policy rules, reported to clients when a
+// destination is rejected.
+const (
+	RuleScheme      = "scheme"
+	RuleShortDomain = "short_domain"
+	RulePrivateHost = "private_host"
+	RuleBlocklist   = "blocklist"
+)
+
+// URLPolicy decides whether a destination may be shortened. Check returns a
+// *interfaces.PolicyError for destinations it rejects.
+type URLPolicy interface {
+	Check(ctx context.Context, u *neturl.URL) error
+}
+
+// PolicyChain runs policies in order and stops at the first rejection.
+type PolicyChain []URLPolicy
+
+func (c PolicyChain) Check(ctx context.Context, u *neturl.URL) error {
+	for _, p := range c {
+		if err := p.Check(ctx, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemeAllowlist only admits destinations whose scheme is listed.
+type SchemeAllowlist map[string]bool
+
+func NewSchemeAllowlist(schemes []string) SchemeAllowlist {
+	allowed := make(SchemeAllowlist, len(schemes))
+	for _, scheme := range schemes {
+		allowed[strings.ToLower(scheme)] = true
+	}
+	return allowed
+}
+
+func (a SchemeAllowlist) Check(ctx context.Context, u *neturl.URL) error {
+	if !a[strings.ToLower(u.Scheme)] {
+		return &interfaces.PolicyError{
+			Rule:   RuleScheme,
+			Reason: fmt.Sprintf("scheme %q is not allowed", u.Scheme),
+		}
+	}
+	return nil
+}
+
+// shortDomainPolicy rejects links back to our own short domains, which would
+// redirect in a loop.
+type shortDomainPolicy struct {
+	domains *domainSet
+}
+
+func (p shortDomainPolicy) Check(ctx context.Context, u *neturl.URL) error {
+	if p.domains.isShortHost(u.Hostname()) {
+		return &interfaces.PolicyError{
+			Rule:   RuleShortDomain,
+			Reason: fmt.Sprintf("%q is one of this service's short domains", u.Hostname()),
+		}
+	}
+	return nil
+}
+
+// blockedNetworks are address ranges that are never valid public
+// destinations, on top of what the net.IP predicates already cover.
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",     // "this" network
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// PrivateHostPolicy rejects destinations on loopback, private, link-local and
+// other non-public addresses. When Resolver is set, host names are resolved
+// too so names pointing at internal addresses are caught; lookup failures
+// are not treated as rejections.
+type PrivateHostPolicy struct {
+	Resolver *net.Resolver
+}
+
+func (p PrivateHostPolicy) Check(ctx context.Context, u *neturl.URL) error {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return nil
+	}
+
+	reject := func(reason string) error {
+		return &interfaces.PolicyError{Rule: RulePrivateHost, Reason: reason}
+	}
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return reject(fmt.Sprintf("%q is a loopback host", host))
+	}
+
+	if ip := parseHostIP(host); ip != nil {
+		if isNonPublicIP(ip) {
+			return reject(fmt.Sprintf("%s is not a public address", ip))
+		}
+		return nil
+	}
+
+	if p.Resolver == nil {
+		return nil
+	}
+	addrs, err := p.Resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if isNonPublicIP(addr.IP) {
+			return reject(fmt.Sprintf("%q resolves to non-public address %s", host, addr.IP))
+		}
+	}
+	return nil
+}
+
+// parseHostIP parses an IP literal host, including every IPv4 form browsers
+// accept: one to four parts, each decimal, octal (leading 0) or hex (0x), the
+// last filling the remaining bytes (http://127.1/, http://0x7f.0.0.1/,
+// http://2130706433/). This follows the WHATWG URL host parser.
+func parseHostIP(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	numbers := make([]uint64, len(parts))
+	for i, part := range parts {
+		n, ok := parseIPv4Number(part)
+		if !ok {
+			return nil
+		}
+		numbers[i] = n
+	}
+
+	last := len(numbers) - 1
+	if numbers[last] >= 1<<(8*(4-last)) {
+		return nil
+	}
+	n := numbers[last]
+	for i, part := range numbers[:last] {
+		if part > 255 {
+			return nil
+		}
+		n += part << (8 * (3 - i))
+	}
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+// parseIPv4Number parses one part of an IPv4 host: hex with a 0x prefix,
+// octal with a leading 0, and decimal otherwise.
+func parseIPv4Number(part string) (uint64, bool) {
+	if part == "" {
+		return 0, false
+	}
+	base := 10
+	switch {
+	case len(part) >= 2 && (part[:2] == "0x" || part[:2] == "0X"):
+		part, base = part[2:], 16
+		if part == "" {
+			return 0, true
+		}
+	case len(part) >= 2 && part[0] == '0':
+		part, base = part[1:], 8
+	}
+	// Larger values are never valid and could overflow
+	n, err := strconv.ParseUint(part, base, 32)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func isNonPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Blocklist rejects destinations on listed domains and their subdomains. It
+// is loaded from a file with one domain per line ('#' starts a comment) and
+// can be reloaded while the service is running. Internationalized entries
+// are stored in punycode to match canonical destinations.
+type Blocklist struct {
+	path string
+
+	mu      sync.RWMutex
+	domains map[string]bool
+}
+
+// NewBlocklist loads the blocklist at path.
+func NewBlocklist(path string) (*Blocklist, error) {
+	b := &Blocklist{path: path}
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Reload re-reads the blocklist file. On error the previous list stays in
+// effect.
+func (b *Blocklist) Reload() error {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return fmt.Errorf("failed to open blocklist: %w", err)
+	}
+	defer f.Close()
+
+	domains := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSuffix(strings.TrimSpace(line), ".")
+		if line == "" {
+			continue
+		}
+		// Destinations are matched in canonical (punycode) form
+		domain, err := canonicalHost(line)
+		if err != nil {
+			return fmt.Errorf("invalid blocklist entry %q: %w", line, err)
+		}
+		domains[domain] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read blocklist: %w", err)
+	}
+
+	b.mu.Lock()
+	b.domains = domains
+	b.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of blocked domains.
+func (b *Blocklist) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.domains)
+}
+
+func (b *Blocklist) Check(ctx context.Context, u *neturl.URL) error {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for domain := host; domain != ""; {
+		if b.domains[domain] {
+			return &interfaces.PolicyError{
+				Rule:   RuleBlocklist,
+				Reason: fmt.Sprintf("%q is blocklisted", domain),
+			}
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			break
+		}
+		domain = parent
+	}
+	return nil
+}
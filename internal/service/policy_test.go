@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+func TestURLService_ShortenURL_Policy(t *testing.T) {
+	service := NewURLService(newMockURLRepository(), nil, nil, testConfig())
+
+	tests := []struct {
+		url      string
+		wantRule string
+	}{
+		{"https://example.com/page", ""},
+		{"javascript:alert(1)", RuleScheme},
+		{"file:///etc/passwd", RuleScheme},
+		{"data:text/html,<script>alert(1)</script>", RuleScheme},
+		{"https://sho.rt/abc123", RuleShortDomain},
+		{"https://GO.example.com/abc123", RuleShortDomain},
+		{"http://localhost:6379/", RulePrivateHost},
+		{"http://127.0.0.1/admin", RulePrivateHost},
+		{"http://10.1.2.3/", RulePrivateHost},
+		{"http://169.254.169.254/latest/meta-data/", RulePrivateHost},
+		{"http://[::1]:8080/", RulePrivateHost},
+		{"http://2130706433/", RulePrivateHost},
+		{"http://127.1/", RulePrivateHost},
+		{"http://0x7f.0.0.1/", RulePrivateHost},
+		{"http://0177.0.0.1/", RulePrivateHost},
+		{"http://0x7f000001/", RulePrivateHost},
+		{"http://017700000001/", RulePrivateHost},
+		{"http://10.0x10203/", RulePrivateHost},
+		{"http://0xA9.254.169.254/", RulePrivateHost},
+		{"http://127.000.000.001/", RulePrivateHost},
+		{"http://0/", RulePrivateHost},
+		{"http://8.8.8.8/", ""},
+		{"http://8.8.2056/", ""},
+		{"http://0x8.010.8.8/", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := service.ShortenURL(context.Background(), &models.ShortenRequest{URL: tt.url})
+
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Fatalf("Expected %s to be allowed, got %v", tt.url, err)
+				}
+				return
+			}
+
+			var policyErr *interfaces.PolicyError
+			if !errors.As(err, &policyErr) || !errors.Is(err, interfaces.ErrURLRejected) {
+				t.Fatalf("Expected a policy error, got %v", err)
+			}
+			if policyErr.Rule != tt.wantRule {
+				t.Errorf("Expected rule %s, got %s", tt.wantRule, policyErr.Rule)
+			}
+		})
+	}
+}
+
+func TestURLService_UpdateURL_Policy(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, nil, nil, testConfig())
+	ctx := context.Background()
+
+	created, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com", OwnerID: "team-a"})
+	if err != nil {
+		t.Fatalf("ShortenURL failed: %v", err)
+	}
+
+	_, err = service.UpdateURL(ctx, "team-a", "", created.ShortCode, &models.UpdateURLRequest{URL: "http://192.168.0.1/"})
+	if !errors.Is(err, interfaces.ErrURLRejected) {
+		t.Errorf("Expected ErrURLRejected, got %v", err)
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("# phishing\nevil.example\n\nBad.Example.  # trailing comment\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	blocklist, err := NewBlocklist(path)
+	if err != nil {
+		t.Fatalf("NewBlocklist failed: %v", err)
+	}
+	if blocklist.Len() != 2 {
+		t.Errorf("Expected 2 domains, got %d", blocklist.Len())
+	}
+
+	service := NewURLService(newMockURLRepository(), nil, nil, testConfig(), blocklist)
+	shorten := func(url string) error {
+		_, err := service.ShortenURL(context.Background(), &models.ShortenRequest{URL: url})
+		return err
+	}
+
+	for _, url := range []string{"https://evil.example/x", "https://login.evil.example/", "http://bad.example/"} {
+		var policyErr *interfaces.PolicyError
+		if err := shorten(url); !errors.As(err, &policyErr) || policyErr.Rule != RuleBlocklist {
+			t.Errorf("Expected %s to be blocklisted, got %v", url, err)
+		}
+	}
+	if err := shorten("https://notevil.example/"); err != nil {
+		t.Errorf("Expected unlisted domain to be allowed, got %v", err)
+	}
+
+	// Internationalized entries match the punycode form of destinations
+	if err := os.WriteFile(path, []byte("bücher.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := blocklist.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if err := shorten("https://BÜCHER.example/"); !errors.Is(err, interfaces.ErrURLRejected) {
+		t.Errorf("Expected IDN destination to be blocklisted, got %v", err)
+	}
+
+	// Reloading picks up changes without recreating the service
+	if err := os.WriteFile(path, []byte("notevil.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := blocklist.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if err := shorten("https://evil.example/x"); err != nil {
+		t.Errorf("Expected evil.example to be allowed after reload, got %v", err)
+	}
+	if err := shorten("https://notevil.example/"); !errors.Is(err, interfaces.ErrURLRejected) {
+		t.Errorf("Expected notevil.example to be blocked after reload, got %v", err)
+	}
+
+	// A failed reload keeps the previous list
+	os.Remove(path)
+	if err := blocklist.Reload(); err == nil {
+		t.Error("Expected reload of a missing file to fail")
+	}
+	if blocklist.Len() != 1 {
+		t.Errorf("Expected previous list to stay in effect, got %d domains", blocklist.Len())
+	}
+}
+
+func TestSchemeAllowlist(t *testing.T) {
+	allowlist := NewSchemeAllowlist([]string{"HTTPS"})
+
+	u, _ := neturl.Parse("https://example.com")
+	if err := allowlist.Check(context.Background(), u); err != nil {
+		t.Errorf("Expected https to be allowed, got %v", err)
+	}
+	u, _ = neturl.Parse("http://example.com")
+	if err := allowlist.Check(context.Background(), u); err == nil {
+		t.Error("Expected http to be rejected")
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// QuotaService enforces the daily and monthly link quotas of API keys'
+// plans. Links are reserved before they are created and the unused part of
+// a reservation is given back afterwards, so concurrent requests cannot
+// create more links than the quota allows between them.
+type QuotaService struct {
+	usage interfaces.UsageRepository
+	now   func() time.Time
+}
+
+func NewQuotaService(usage interfaces.UsageRepository) *QuotaService {
+	return &QuotaService{usage: usage, now: time.Now}
+}
+
+// ReserveLinks returns an *interfaces.QuotaExceededError if the key cannot
+// create n more links. Links are counted for every key, so usage can be
+// reported for keys without a quota too; requests without a key are not
+// counted.
+func (s *QuotaService) ReserveLinks(ctx context.Context, key *models.APIKey, n int) (func(created int), error) {
+	if key == nil || n <= 0 {
+		return func(int) {}, nil
+	}
+
+	now := s.now()
+	if err := s.usage.ReserveLinks(ctx, key, n, now); err != nil {
+		return nil, err
+	}
+
+	// The release outlives the request if the client goes away meanwhile
+	ctx = context.WithoutCancel(ctx)
+	return func(created int) {
+		unused := n - created
+		if unused <= 0 {
+			return
+		}
+		if err := s.usage.ReleaseLinks(ctx, key.ID, unused, now); err != nil {
+			log.Printf("Warning: failed to release %d links for API key %d: %v", unused, key.ID, err)
+		}
+	}, nil
+}
+
+// Usage reports the links the key created today and this month against its
+// plan's quota.
+func (s *QuotaService) Usage(ctx context.Context, key *models.APIKey) (*models.Usage, error) {
+	now := s.now()
+	day, month, err := s.usage.CountLinks(ctx, key.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	dayResetsAt, monthResetsAt := models.QuotaResets(now)
+	return &models.Usage{
+		Plan:           key.Plan,
+		Quota:          key.Quota,
+		LinksToday:     day,
+		LinksThisMonth: month,
+		DayResetsAt:    dayResetsAt,
+		MonthResetsAt:  monthResetsAt,
+	}, nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+	"github.com/jonmanahan/url-shortener/internal/repository"
+)
+
+func newTestQuotaService(t *testing.T, plan string) (*QuotaService, *models.APIKey) {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	key, err := repository.NewMemoryAPIKeyRepository(store).CreateAPIKey(context.Background(), &models.APIKey{
+		OwnerID: "owner-1",
+		KeyHash: "hash",
+		Plan:    plan,
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+
+	s := NewQuotaService(repository.NewMemoryUsageRepository(store))
+	s.now = func() time.Time { return time.Date(2026, 2, 14, 18, 30, 0, 0, time.UTC) }
+	return s, key
+}
+
+func TestQuotaService_ReleasesUnusedLinks(t *testing.T) {
+	ctx := context.Background()
+	s, key := newTestQuotaService(t, "free")
+
+	release, err := s.ReserveLinks(ctx, key, 10)
+	if err != nil {
+		t.Fatalf("ReserveLinks failed: %v", err)
+	}
+	release(4)
+
+	usage, err := s.Usage(ctx, key)
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if usage.LinksToday != 4 || usage.LinksThisMonth != 4 {
+		t.Errorf("Expected 4 links used after releasing 6, got %+v", usage)
+	}
+	if usage.Plan != "free" || usage.Quota != key.Quota {
+		t.Errorf("Expected the free plan's quota, got %s %+v", usage.Plan, usage.Quota)
+	}
+
+	wantDay := time.Date(2026, 2, 15, 0, 0, 0, 0, time.UTC)
+	wantMonth := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	if !usage.DayResetsAt.Equal(wantDay) || !usage.MonthResetsAt.Equal(wantMonth) {
+		t.Errorf("Expected resets at %v and %v, got %v and %v", wantDay, wantMonth, usage.DayResetsAt, usage.MonthResetsAt)
+	}
+}
+
+func TestQuotaService_QuotaExceeded(t *testing.T) {
+	s, key := newTestQuotaService(t, "free")
+
+	_, err := s.ReserveLinks(context.Background(), key, key.Quota.LinksPerDay+1)
+	var quotaErr *interfaces.QuotaExceededError
+	if !errors.As(err, &quotaErr) || quotaErr.Period != interfaces.QuotaPeriodDay {
+		t.Fatalf("Expected the daily quota to be exceeded, got %v", err)
+	}
+	if want := time.Date(2026, 2, 15, 0, 0, 0, 0, time.UTC); !quotaErr.ResetsAt.Equal(want) {
+		t.Errorf("Expected the quota to reset at %v, got %v", want, quotaErr.ResetsAt)
+	}
+}
+
+func TestQuotaService_Unlimited(t *testing.T) {
+	ctx := context.Background()
+	s, key := newTestQuotaService(t, "unlimited")
+
+	for _, k := range []*models.APIKey{nil, key} {
+		release, err := s.ReserveLinks(ctx, k, 100_000)
+		if err != nil {
+			t.Fatalf("ReserveLinks failed: %v", err)
+		}
+		release(100_000)
+	}
+
+	// Unlimited keys are still counted
+	usage, err := s.Usage(ctx, key)
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if usage.LinksToday != 100_000 {
+		t.Errorf("Expected 100000 links used, got %+v", usage)
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+	"github.com/jonmanahan/url-shortener/internal/repository"
+)
+
+// countingURLRepository counts short code lookups and can hold them until
+// release is closed.
+type countingURLRepository struct {
+	interfaces.URLRepository
+	lookups atomic.Int32
+	release chan struct{}
+}
+
+func (r *countingURLRepository) GetURLByShortCode(ctx context.Context, domain, shortCode string) (*models.URL, error) {
+	r.lookups.Add(1)
+	if r.release != nil {
+		<-r.release
+	}
+	return r.URLRepository.GetURLByShortCode(ctx, domain, shortCode)
+}
+
+func newCountingRepository(t *testing.T) *countingURLRepository {
+	t.Helper()
+	repo := &countingURLRepository{URLRepository: repository.NewMemoryURLRepository(repository.NewMemoryStore())}
+	_, err := repo.CreateURL(context.Background(), &models.URL{
+		OriginalURL: "https://example.com", ShortCode: "abc", RedirectType: 302,
+	})
+	if err != nil {
+		t.Fatalf("CreateURL failed: %v", err)
+	}
+	return repo
+}
+
+func TestURLService_ResolveURL_CoalescesMisses(t *testing.T) {
+	repo := newCountingRepository(t)
+	repo.release = make(chan struct{})
+	service := NewURLService(repo, repository.NewMemoryCache(), nil, testConfig())
+
+	const callers = 20
+	var wg sync.WaitGroup
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = service.ResolveURL(context.Background(), "sho.rt", "abc")
+		}(i)
+	}
+
+	// Let the callers pile up behind the first lookup
+	for repo.lookups.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(repo.release)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Caller %d failed: %v", i, err)
+		}
+	}
+	if n := repo.lookups.Load(); n != 1 {
+		t.Errorf("Expected 1 database lookup, got %d", n)
+	}
+}
+
+func TestURLService_ResolveURL_CachesMisses(t *testing.T) {
+	repo := newCountingRepository(t)
+	service := NewURLService(repo, repository.NewMemoryCache(), nil, testConfig())
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := service.ResolveURL(ctx, "sho.rt", "missing"); !errors.Is(err, interfaces.ErrLinkNotFound) {
+			t.Fatalf("Expected ErrLinkNotFound, got %v", err)
+		}
+	}
+	if n := repo.lookups.Load(); n != 1 {
+		t.Errorf("Expected unknown code to be looked up once, got %d", n)
+	}
+
+	// A link created after the miss was cached resolves straight away
+	if _, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.org", Alias: "missing"}); err != nil {
+		t.Fatalf("ShortenURL failed: %v", err)
+	}
+	url, err := service.ResolveURL(ctx, "sho.rt", "missing")
+	if err != nil || url.OriginalURL != "https://example.org" {
+		t.Errorf("Expected new alias to resolve, got %+v (%v)", url, err)
+	}
+}
+
+func TestURLService_ResolveURL_CachesExpiredLinks(t *testing.T) {
+	repo := newCountingRepository(t)
+	expired := time.Now().Add(-time.Minute)
+	_, err := repo.CreateURL(context.Background(), &models.URL{
+		OriginalURL: "https://example.org", ShortCode: "old", RedirectType: 302, ExpiresAt: &expired,
+	})
+	if err != nil {
+		t.Fatalf("CreateURL failed: %v", err)
+	}
+	service := NewURLService(repo, repository.NewMemoryCache(), nil, testConfig())
+
+	for i := 0; i < 3; i++ {
+		if _, err := service.ResolveURL(context.Background(), "sho.rt", "old"); !errors.Is(err, interfaces.ErrLinkExpired) {
+			t.Fatalf("Expected ErrLinkExpired, got %v", err)
+		}
+	}
+	if n := repo.lookups.Load(); n != 1 {
+		t.Errorf("Expected expired link to be looked up once, got %d", n)
+	}
+}
+
+func TestURLService_ResolveURL_RefreshesStaleEntries(t *testing.T) {
+	repo := newCountingRepository(t)
+	cache := repository.NewMemoryCache()
+	service := NewURLService(repo, cache, nil, testConfig())
+	ctx := context.Background()
+
+	// A stale entry pointing at an outdated destination
+	staleSince := time.Now().Add(-time.Minute)
+	b, _ := json.Marshal(cachedURL{OriginalURL: "https://old.example.com", RedirectType: 302, FreshUntil: &staleSince})
+	if err := cache.Set(ctx, urlCacheKey(PrimaryDomain, "abc"), string(b), time.Hour); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	url, err := service.ResolveURL(ctx, "sho.rt", "abc")
+	if err != nil || url.OriginalURL != "https://old.example.com" {
+		t.Fatalf("Expected stale entry to be served, got %+v (%v)", url, err)
+	}
+
+	// The background refresh replaces it with the current destination
+	deadline := time.Now().Add(time.Second)
+	for {
+		url, err = service.ResolveURL(ctx, "sho.rt", "abc")
+		if err == nil && url.OriginalURL == "https://example.com" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Stale entry was not refreshed, got %+v (%v)", url, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := repo.lookups.Load(); n != 1 {
+		t.Errorf("Expected 1 refresh lookup, got %d", n)
+	}
+}
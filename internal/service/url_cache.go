@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+	"github.com/jonmanahan/url-shortener/internal/models"
+)
+
+// cachedURL is the cached representation of a link: just enough to redirect.
+type cachedURL struct {
+	OriginalURL  string     `json:"u"`
+	RedirectType int        `json:"t"`
+	ExpiresAt    *time.Time `json:"e,omitempty"`
+	// FreshUntil is when the entry becomes stale and should be refreshed
+	// from the database. Entries written without it are always fresh.
+	FreshUntil *time.Time `json:"f,omitempty"`
+}
+
+func encodeCachedURL(url *models.URL) string {
+	freshUntil := time.Now().Add(cacheFreshTTL)
+	b, _ := json.Marshal(cachedURL{
+		OriginalURL:  url.OriginalURL,
+		RedirectType: url.RedirectType,
+		ExpiresAt:    url.ExpiresAt,
+		FreshUntil:   &freshUntil,
+	})
+	return string(b)
+}
+
+// decodeCachedURL parses a cache value. Values written before redirect types
+// were cached (bare URL strings) do not decode and are treated as misses.
+func decodeCachedURL(domain, shortCode, value string) (*models.URL, bool) {
+	url, _, ok := decodeCachedEntry(domain, shortCode, value)
+	return url, ok
+}
+
+// decodeCachedEntry is decodeCachedURL that also reports whether the entry
+// is still fresh.
+func decodeCachedEntry(domain, shortCode, value string) (*models.URL, bool, bool) {
+	var c cachedURL
+	if err := json.Unmarshal([]byte(value), &c); err != nil || c.OriginalURL == "" || c.RedirectType == 0 {
+		return nil, false, false
+	}
+	url := &models.URL{
+		OriginalURL:  c.OriginalURL,
+		ShortCode:    shortCode,
+		Domain:       domain,
+		RedirectType: c.RedirectType,
+		ExpiresAt:    c.ExpiresAt,
+	}
+	fresh := c.FreshUntil == nil || time.Now().Before(*c.FreshUntil)
+	return url, fresh, true
+}
+
+// cachedURL returns the cached link for a short code, if any, and whether
+// it is still fresh. Links that expired while cached are treated as misses.
+func (s *URLService) cachedURL(ctx context.Context, domain, shortCode string) (*models.URL, bool, bool) {
+	if s.cache == nil {
+		return nil, false, false
+	}
+	value, err := s.cache.Get(ctx, urlCacheKey(domain, shortCode))
+	if err != nil {
+		return nil, false, false
+	}
+	url, fresh, ok := decodeCachedEntry(domain, shortCode, value)
+	if !ok || url.IsExpired(time.Now()) {
+		return nil, false, false
+	}
+	return url, fresh, true
+}
+
+// cacheURL stores the short code -> link mapping in the cache. The entry never
+// outlives the link itself, so expired links fall through to the database
+// where they are rejected.
+func (s *URLService) cacheURL(ctx context.Context, url *models.URL) {
+	if s.cache == nil {
+		return
+	}
+
+	if ttl, ok := cacheTTLFor(url); ok {
+		_ = s.cache.Set(ctx, urlCacheKey(url.Domain, url.ShortCode), encodeCachedURL(url), ttl)
+	}
+}
+
+// Values cached under missCacheKey.
+const (
+	missNotFound = "1"
+	missExpired  = "expired"
+)
+
+// cachedMiss returns ErrLinkNotFound or ErrLinkExpired if the short code was
+// recently looked up and found missing or expired, and nil otherwise.
+func (s *URLService) cachedMiss(ctx context.Context, domain, shortCode string) error {
+	if s.cache == nil {
+		return nil
+	}
+	value, err := s.cache.Get(ctx, missCacheKey(domain, shortCode))
+	if err != nil {
+		return nil
+	}
+	if value == missExpired {
+		return interfaces.ErrLinkExpired
+	}
+	return interfaces.ErrLinkNotFound
+}
+
+// cacheMiss remembers briefly that a short code does not exist or has
+// expired, so repeated lookups of it skip the database. Links created
+// meanwhile are cached under their own key, which is checked first.
+func (s *URLService) cacheMiss(ctx context.Context, domain, shortCode, value string) {
+	if s.cache == nil {
+		return
+	}
+	_ = s.cache.Set(ctx, missCacheKey(domain, shortCode), value, negativeCacheTTL)
+}
+
+// cacheURLs pre-warms the cache for newly created links in one pipeline.
+func (s *URLService) cacheURLs(ctx context.Context, urls []*models.URL) {
+	if s.cache == nil || len(urls) == 0 {
+		return
+	}
+
+	entries := make([]interfaces.CacheEntry, 0, len(urls))
+	for _, url := range urls {
+		if ttl, ok := cacheTTLFor(url); ok {
+			entries = append(entries, interfaces.CacheEntry{
+				Key:        urlCacheKey(url.Domain, url.ShortCode),
+				Value:      encodeCachedURL(url),
+				Expiration: ttl,
+			})
+		}
+	}
+	_ = s.cache.SetMany(ctx, entries)
+}
+
+// cacheTTLFor returns how long a link may be cached, capped at its expiry.
+// It reports false for links that have already expired.
+func cacheTTLFor(url *models.URL) (time.Duration, bool) {
+	ttl := cacheTTL
+	if url.ExpiresAt != nil {
+		remaining := time.Until(*url.ExpiresAt)
+		if remaining <= 0 {
+			return 0, false
+		}
+		if remaining < ttl {
+			ttl = remaining
+		}
+	}
+	return ttl, true
+}
+
+// invalidateURL drops the cached mapping for a link so the next resolve
+// reads the current destination from the database.
+func (s *URLService) invalidateURL(ctx context.Context, domain, shortCode string) {
+	if s.cache == nil {
+		return
+	}
+	_ = s.cache.Del(ctx, urlCacheKey(domain, shortCode), missCacheKey(domain, shortCode))
+}
+
+// urlCacheKey keeps the original url:<code> key for the primary domain and
+// namespaces codes on other domains by host.
+func urlCacheKey(domain, shortCode string) string {
+	if domain == PrimaryDomain {
+		return fmt.Sprintf("url:%s", shortCode)
+	}
+	return fmt.Sprintf("url:%s/%s", domain, shortCode)
+}
+
+// missCacheKey is where a not-found result for urlCacheKey is cached.
+func missCacheKey(domain, shortCode string) string {
+	return "miss:" + urlCacheKey(domain, shortCode)
+}
@@ -2,126 +2,473 @@ package service
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"regexp"
 	"strings"
 	"time"
 
+	"github.com/jonmanahan/url-shortener/internal/config"
 	"github.com/jonmanahan/url-shortener/internal/interfaces"
 	"github.com/jonmanahan/url-shortener/internal/models"
-	"github.com/jonmanahan/url-shortener/internal/repository"
+	"github.com/jonmanahan/url-shortener/internal/shortcode"
 )
 
+const (
+	// cacheTTL is the longest a short code -> URL mapping stays in the cache.
+	cacheTTL = 24 * time.Hour
+	// cacheFreshTTL is how long a cached mapping is served as is. After
+	// that it is still served, but refreshed from the database in the
+	// background.
+	cacheFreshTTL = 5 * time.Minute
+	// negativeCacheTTL is how long an unknown short code is remembered.
+	negativeCacheTTL = 30 * time.Second
+	// refreshTimeout bounds a background refresh of a stale entry.
+	refreshTimeout = 5 * time.Second
+
+	defaultPageSize = 20
+	maxPageSize     = 100
+
+	// maxCodeAttempts bounds how many generated codes are tried when
+	// inserts keep colliding with existing links.
+	maxCodeAttempts = 5
+
+	// maxAliasLength is the size of the urls.short_code column.
+	maxAliasLength = 32
+)
+
+// aliasPattern mirrors the urls_short_code_format check constraint.
+var aliasPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// reservedAliases collide with the service's own routes and cannot be used
+// as custom short codes.
+var reservedAliases = map[string]bool{
+	"api":     true,
+	"health":  true,
+	"livez":   true,
+	"readyz":  true,
+	"shorten": true,
+}
+
+// defaultAllowedSchemes is used when the configuration allows no schemes.
+var defaultAllowedSchemes = []string{"http", "https"}
+
 type URLService struct {
-	repo        interfaces.URLRepository
-	redisClient *repository.RedisClient
+	repo      interfaces.URLRepository
+	cache     interfaces.Cache
+	codes     interfaces.CodeGenerator
+	domains   *domainSet
+	canonical *canonicalizer
+	policy    URLPolicy
+	// lookups coalesces concurrent database reads of the same link.
+	lookups flightGroup
+
+	defaultRedirectType int
 }
 
-func NewURLService(repo interfaces.URLRepository, redisClient *repository.RedisClient) *URLService {
+// NewURLService creates the service. cache may be nil, in which case links
+// are always read from repo and requests are not rate limited. New links get
+// codes from codes, or random base62 codes of the default length if codes is
+// nil. Destinations are checked against the built-in URL policy (allowed
+// schemes, own short domains, private hosts) followed by any extra policies,
+// such as a Blocklist.
+func NewURLService(repo interfaces.URLRepository, cache interfaces.Cache, codes interfaces.CodeGenerator, cfg *config.Config, policies ...URLPolicy) *URLService {
+	if codes == nil {
+		codes, _ = shortcode.NewRandom(shortcode.Base62Alphabet, shortcode.DefaultLength)
+	}
+
+	defaultRedirectType := cfg.DefaultRedirectType
+	if !models.IsValidRedirectType(defaultRedirectType) {
+		defaultRedirectType = http.StatusFound
+	}
+
+	schemes := cfg.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = defaultAllowedSchemes
+	}
+	var privateHosts PrivateHostPolicy
+	if cfg.ResolveDestinationHosts {
+		privateHosts.Resolver = net.DefaultResolver
+	}
+
+	domains := newDomainSet(cfg.BaseURL, cfg.ShortDomains)
+	policy := PolicyChain{
+		NewSchemeAllowlist(schemes),
+		shortDomainPolicy{domains: domains},
+		privateHosts,
+	}
+
 	return &URLService{
-		repo:        repo,
-		redisClient: redisClient,
+		repo:                repo,
+		cache:               cache,
+		codes:               codes,
+		domains:             domains,
+		canonical:           newCanonicalizer(cfg.TrackingParams),
+		policy:              append(policy, policies...),
+		defaultRedirectType: defaultRedirectType,
 	}
 }
 
-func (s *URLService) ShortenURL(ctx context.Context, originalURL string) (*models.ShortenResponse, error) {
-	// Generate a unique short code
-	shortCode, err := s.generateShortCode()
+func (s *URLService) ShortenURL(ctx context.Context, req *models.ShortenRequest) (*models.ShortenResponse, error) {
+	newURL, err := s.prepareURL(ctx, req, time.Now())
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate short code: %w", err)
+		return nil, err
 	}
 
-	// Ensure short code is unique
-	for {
-		exists, err := s.repo.ShortCodeExists(shortCode)
-		if err != nil {
-			return nil, fmt.Errorf("failed to check short code uniqueness: %w", err)
+	existing, err := s.existingURL(ctx, req, newURL)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return s.dedupeResponse(existing), nil
+	}
+
+	url, err := s.createURL(ctx, newURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cache the short code -> original URL mapping if a cache is available
+	s.cacheURL(ctx, url)
+
+	return s.shortenResponse(url), nil
+}
+
+// prepareURL validates a shorten request and builds the link to insert. The
+// short code is only set when the request asks for an alias.
+func (s *URLService) prepareURL(ctx context.Context, req *models.ShortenRequest, now time.Time) (*models.URL, error) {
+	destination, err := s.checkDestination(ctx, req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	domain, err := s.domains.canonical(req.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt, err := resolveExpiry(req, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Alias != "" {
+		if err := validateAlias(req.Alias); err != nil {
+			return nil, err
 		}
-		if !exists {
-			break
+	}
+
+	redirectType := req.RedirectType
+	if redirectType == 0 {
+		redirectType = s.defaultRedirectType
+	}
+	if err := validateRedirectType(redirectType); err != nil {
+		return nil, err
+	}
+
+	return &models.URL{
+		OriginalURL:     req.URL,
+		NormalizedURL:   destination,
+		ShortCode:       req.Alias,
+		Domain:          domain,
+		OwnerID:         req.OwnerID,
+		DestinationHash: destinationHash(destination),
+		RedirectType:    redirectType,
+		ExpiresAt:       expiresAt,
+	}, nil
+}
+
+func (s *URLService) shortenResponse(url *models.URL) *models.ShortenResponse {
+	return &models.ShortenResponse{
+		ShortCode:    url.ShortCode,
+		OriginalURL:  url.OriginalURL,
+		ShortURL:     s.domains.shortURL(url.Domain, url.ShortCode),
+		Domain:       url.Domain,
+		RedirectType: url.RedirectType,
+		ExpiresAt:    url.ExpiresAt,
+	}
+}
+
+// checkDestination checks that a destination is an absolute URL allowed by
+// the URL policy and returns its canonical form. The policy sees the
+// canonical URL and runs before the host check so that hostless schemes such
+// as javascript: are reported as policy rejections.
+func (s *URLService) checkDestination(ctx context.Context, raw string) (string, error) {
+	u, err := neturl.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return "", fmt.Errorf("%w: must be an absolute URL", interfaces.ErrInvalidURL)
+	}
+	canonical, err := s.canonical.canonicalize(u)
+	if err != nil {
+		return "", err
+	}
+	if err := s.policy.Check(ctx, canonical); err != nil {
+		return "", err
+	}
+	if canonical.Host == "" {
+		return "", fmt.Errorf("%w: must be an absolute URL", interfaces.ErrInvalidURL)
+	}
+	return canonical.String(), nil
+}
+
+// resolveExpiry turns the request's absolute expiry or TTL into a timestamp.
+// A nil result means the link never expires.
+func resolveExpiry(req *models.ShortenRequest, now time.Time) (*time.Time, error) {
+	switch {
+	case req.TTLSeconds < 0:
+		return nil, fmt.Errorf("%w: ttl_seconds must be positive", interfaces.ErrInvalidExpiry)
+	case req.ExpiresAt != nil && req.TTLSeconds > 0:
+		return nil, fmt.Errorf("%w: set either expires_at or ttl_seconds, not both", interfaces.ErrInvalidExpiry)
+	case req.ExpiresAt != nil:
+		if !req.ExpiresAt.After(now) {
+			return nil, fmt.Errorf("%w: expires_at must be in the future", interfaces.ErrInvalidExpiry)
+		}
+		expiresAt := req.ExpiresAt.UTC()
+		return &expiresAt, nil
+	case req.TTLSeconds > 0:
+		expiresAt := now.Add(time.Duration(req.TTLSeconds) * time.Second).UTC()
+		return &expiresAt, nil
+	default:
+		return nil, nil
+	}
+}
+
+// validateAlias checks a caller-supplied alias against the short code format
+// and the reserved route names.
+func validateAlias(alias string) error {
+	if len(alias) > maxAliasLength {
+		return fmt.Errorf("%w: must be at most %d characters", interfaces.ErrInvalidAlias, maxAliasLength)
+	}
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("%w: only letters, digits, '-' and '_' are allowed", interfaces.ErrInvalidAlias)
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("%w: %q is reserved", interfaces.ErrInvalidAlias, alias)
+	}
+	return nil
+}
+
+func validateRedirectType(redirectType int) error {
+	if !models.IsValidRedirectType(redirectType) {
+		return fmt.Errorf("%w: %d is not one of 301, 302, 307 or 308", interfaces.ErrInvalidRedirectType, redirectType)
+	}
+	return nil
+}
+
+// createURL inserts a link, relying on the database's unique constraint
+// rather than a separate existence check so concurrent requests cannot
+// claim the same code. A taken alias is reported as ErrAliasTaken; a
+// generated code that collides is replaced and retried up to
+// maxCodeAttempts times.
+func (s *URLService) createURL(ctx context.Context, newURL *models.URL) (*models.URL, error) {
+	if newURL.ShortCode != "" {
+		url, err := s.repo.CreateURL(ctx, newURL)
+		if errors.Is(err, interfaces.ErrConflict) {
+			return nil, interfaces.ErrAliasTaken
 		}
-		shortCode, err = s.generateShortCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create URL: %w", err)
+		}
+		return url, nil
+	}
+
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		shortCode, err := s.codes.Generate(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate short code: %w", err)
 		}
+		newURL.ShortCode = shortCode
+
+		url, err := s.repo.CreateURL(ctx, newURL)
+		if errors.Is(err, interfaces.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create URL: %w", err)
+		}
+		return url, nil
 	}
 
-	// Create URL in database
-	url, err := s.repo.CreateURL(originalURL, shortCode)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create URL: %w", err)
+	return nil, &interfaces.KeyspaceExhaustedError{Domain: newURL.Domain, Attempts: maxCodeAttempts}
+}
+
+// ResolveURL looks up a short code on the domain served at host. The result
+// carries what is needed to redirect: destination, redirect type and expiry.
+func (s *URLService) ResolveURL(ctx context.Context, host, shortCode string) (*models.URL, error) {
+	domain := s.domains.forHost(host)
+
+	// Try the cache first if available; stale entries are served while a
+	// single background refresh runs
+	if url, fresh, ok := s.cachedURL(ctx, domain, shortCode); ok {
+		if !fresh {
+			s.lookups.doBackground(urlCacheKey(domain, shortCode), func() (*models.URL, error) {
+				return s.refreshURL(domain, shortCode)
+			})
+		}
+		return url, nil
+	}
+	if err := s.cachedMiss(ctx, domain, shortCode); err != nil {
+		return nil, err
 	}
 
-	// Cache the short code -> original URL mapping if Redis is available
-	if s.redisClient != nil {
-		cacheKey := fmt.Sprintf("url:%s", shortCode)
-		_ = s.redisClient.Set(ctx, cacheKey, originalURL, 24*time.Hour)
+	// Fallback to database, with one lookup shared by concurrent misses. The
+	// lookup outlives any single caller's cancellation.
+	lookupCtx := context.WithoutCancel(ctx)
+	url, err := s.lookups.do(urlCacheKey(domain, shortCode), func() (*models.URL, error) {
+		return s.loadURL(lookupCtx, domain, shortCode)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if url.IsExpired(time.Now()) {
+		return nil, interfaces.ErrLinkExpired
 	}
 
-	return &models.ShortenResponse{
-		ShortCode:   url.ShortCode,
-		OriginalURL: url.OriginalURL,
-		ShortURL:    fmt.Sprintf("http://localhost:8080/%s", url.ShortCode),
-	}, nil
+	return url, nil
 }
 
-func (s *URLService) ResolveURL(ctx context.Context, shortCode string) (string, error) {
-	// Try Redis cache first if available
-	if s.redisClient != nil {
-		cacheKey := fmt.Sprintf("url:%s", shortCode)
-		if originalURL, err := s.redisClient.Get(ctx, cacheKey); err == nil {
-			return originalURL, nil
-		}
+// refreshURL reloads a stale cache entry. A link deleted behind the cache's
+// back has its entry dropped; on other errors the stale entry keeps being
+// served until it expires.
+func (s *URLService) refreshURL(domain, shortCode string) (*models.URL, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	url, err := s.loadURL(ctx, domain, shortCode)
+	if errors.Is(err, interfaces.ErrLinkNotFound) {
+		s.invalidateURL(ctx, domain, shortCode)
 	}
+	return url, err
+}
 
-	// Fallback to database
-	url, err := s.repo.GetURLByShortCode(shortCode)
+// loadURL reads a link from the database and updates the cache: live links
+// are cached, and unknown codes and expired links are cached as misses.
+func (s *URLService) loadURL(ctx context.Context, domain, shortCode string) (*models.URL, error) {
+	url, err := s.repo.GetURLByShortCode(ctx, domain, shortCode)
+	if errors.Is(err, interfaces.ErrNotFound) {
+		s.cacheMiss(ctx, domain, shortCode, missNotFound)
+		return nil, interfaces.ErrLinkNotFound
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve URL: %w", err)
+		return nil, fmt.Errorf("failed to resolve URL: %w", err)
 	}
 
-	// Update cache if Redis is available
-	if s.redisClient != nil {
-		cacheKey := fmt.Sprintf("url:%s", shortCode)
-		_ = s.redisClient.Set(ctx, cacheKey, url.OriginalURL, 24*time.Hour)
+	// Update the cache if available
+	if url.IsExpired(time.Now()) {
+		s.cacheMiss(ctx, domain, shortCode, missExpired)
+	} else {
+		s.cacheURL(ctx, url)
 	}
 
-	return url.OriginalURL, nil
+	return url, nil
 }
 
-func (s *URLService) CheckRateLimit(ctx context.Context, clientIP string) (bool, error) {
-	if s.redisClient == nil {
-		// If no Redis, allow all requests
-		return true, nil
+// ShortURL returns the public short URL for a live link on the domain
+// served at host.
+func (s *URLService) ShortURL(ctx context.Context, host, shortCode string) (string, error) {
+	url, err := s.ResolveURL(ctx, host, shortCode)
+	if err != nil {
+		return "", err
 	}
+	return s.domains.shortURL(url.Domain, url.ShortCode), nil
+}
 
-	// Rate limit: 10 requests per minute per IP
-	key := fmt.Sprintf("rate_limit:%s", clientIP)
-	count, err := s.redisClient.IncrementWithExpiry(ctx, key, time.Minute)
+func (s *URLService) ListURLs(ctx context.Context, ownerID string, page, pageSize int) (*models.URLList, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	urls, total, err := s.repo.ListURLsByOwner(ctx, ownerID, pageSize, (page-1)*pageSize)
 	if err != nil {
-		// If Redis fails, allow the request
-		return true, nil
+		return nil, fmt.Errorf("failed to list URLs: %w", err)
 	}
 
-	return count <= 10, nil
+	return &models.URLList{
+		URLs:     urls,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}, nil
 }
 
-func (s *URLService) generateShortCode() (string, error) {
-	// Generate 6 random bytes and encode as base64
-	bytes := make([]byte, 6)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
+func (s *URLService) GetURL(ctx context.Context, ownerID, domain, shortCode string) (*models.URL, error) {
+	return s.ownedURL(ctx, ownerID, domain, shortCode)
+}
+
+func (s *URLService) UpdateURL(ctx context.Context, ownerID, domain, shortCode string, req *models.UpdateURLRequest) (*models.URL, error) {
+	url, err := s.ownedURL(ctx, ownerID, domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.URL != "" {
+		destination, err := s.checkDestination(ctx, req.URL)
+		if err != nil {
+			return nil, err
+		}
+		url.OriginalURL = req.URL
+		url.NormalizedURL = destination
+		url.DestinationHash = destinationHash(destination)
+	}
+	if req.RedirectType != 0 {
+		if err := validateRedirectType(req.RedirectType); err != nil {
+			return nil, err
+		}
+		url.RedirectType = req.RedirectType
+	}
+
+	updated, err := s.repo.UpdateURL(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update URL: %w", err)
 	}
 
-	// Use URL-safe base64 encoding and remove padding
-	shortCode := base64.URLEncoding.EncodeToString(bytes)
-	shortCode = strings.TrimRight(shortCode, "=")
+	s.invalidateURL(ctx, url.Domain, shortCode)
 
-	// Ensure it's not too long
-	if len(shortCode) > 8 {
-		shortCode = shortCode[:8]
+	return updated, nil
+}
+
+func (s *URLService) DeleteURL(ctx context.Context, ownerID, domain, shortCode string) error {
+	url, err := s.ownedURL(ctx, ownerID, domain, shortCode)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteURL(ctx, url.Domain, shortCode); err != nil {
+		return fmt.Errorf("failed to delete URL: %w", err)
+	}
+
+	s.invalidateURL(ctx, url.Domain, shortCode)
+
+	return nil
+}
+
+// ownedURL loads a link and checks it belongs to ownerID. Links owned by
+// someone else are reported as not found so their existence is not leaked.
+func (s *URLService) ownedURL(ctx context.Context, ownerID, domain, shortCode string) (*models.URL, error) {
+	domain, err := s.domains.canonical(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := s.repo.GetURLByShortCode(ctx, domain, shortCode)
+	if errors.Is(err, interfaces.ErrNotFound) {
+		return nil, interfaces.ErrLinkNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up short code: %w", err)
+	}
+	if url.OwnerID != ownerID {
+		return nil, interfaces.ErrLinkNotFound
 	}
 
-	return shortCode, nil
+	return url, nil
 }
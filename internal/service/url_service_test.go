@@ -3,16 +3,34 @@ package service
 import (
 	"context"
 	"errors"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jonmanahan/url-shortener/internal/config"
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
 	"github.com/jonmanahan/url-shortener/internal/models"
 )
 
-// Mock repository for testing
+// testConfig returns the configuration used by service tests.
+func testConfig() *config.Config {
+	return &config.Config{
+		BaseURL:             "https://sho.rt",
+		ShortDomains:        []string{"go.example.com"},
+		DefaultRedirectType: http.StatusFound,
+	}
+}
+
+// Mock repository for testing. Links on the primary domain are keyed by
+// short code alone, others by domain + "/" + short code.
 type mockURLRepository struct {
 	urls       map[string]*models.URL
 	shortCodes map[string]bool
 	shouldFail bool
+	// conflicts makes the next CreateURL calls report a taken code, as if
+	// another request had inserted it first.
+	conflicts int
 }
 
 func newMockURLRepository() *mockURLRepository {
@@ -22,47 +40,144 @@ func newMockURLRepository() *mockURLRepository {
 	}
 }
 
-func (m *mockURLRepository) CreateURL(originalURL, shortCode string) (*models.URL, error) {
+func (m *mockURLRepository) CreateURL(ctx context.Context, u *models.URL) (*models.URL, error) {
 	if m.shouldFail {
 		return nil, errors.New("mock error")
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if m.conflicts > 0 || m.shortCodes[mockKey(u.Domain, u.ShortCode)] {
+		if m.conflicts > 0 {
+			m.conflicts--
+		}
+		return nil, interfaces.ErrConflict
+	}
 
 	url := &models.URL{
-		ID:          1,
-		OriginalURL: originalURL,
-		ShortCode:   shortCode,
+		ID:           1,
+		OriginalURL:  u.OriginalURL,
+		ShortCode:    u.ShortCode,
+		Domain:       u.Domain,
+		OwnerID:      u.OwnerID,
+		RedirectType: u.RedirectType,
+		ExpiresAt:    u.ExpiresAt,
+
+		NormalizedURL:   u.NormalizedURL,
+		DestinationHash: u.DestinationHash,
 	}
-	m.urls[shortCode] = url
-	m.shortCodes[shortCode] = true
+	m.urls[mockKey(u.Domain, u.ShortCode)] = url
+	m.shortCodes[mockKey(u.Domain, u.ShortCode)] = true
 	return url, nil
 }
 
-func (m *mockURLRepository) GetURLByShortCode(shortCode string) (*models.URL, error) {
+func mockKey(domain, shortCode string) string {
+	if domain == "" {
+		return shortCode
+	}
+	return domain + "/" + shortCode
+}
+
+func (m *mockURLRepository) CreateURLs(ctx context.Context, urls []*models.URL) ([]*models.URL, error) {
+	if m.shouldFail {
+		return nil, errors.New("mock error")
+	}
+
+	var created []*models.URL
+	for _, u := range urls {
+		if m.shortCodes[mockKey(u.Domain, u.ShortCode)] {
+			continue
+		}
+		url, _ := m.CreateURL(ctx, u)
+		created = append(created, url)
+	}
+	return created, nil
+}
+
+func (m *mockURLRepository) GetURLByShortCode(ctx context.Context, domain, shortCode string) (*models.URL, error) {
 	if m.shouldFail {
 		return nil, errors.New("mock error")
 	}
 
-	if url, exists := m.urls[shortCode]; exists {
+	if url, exists := m.urls[mockKey(domain, shortCode)]; exists {
 		return url, nil
 	}
-	return nil, errors.New("URL not found")
+	return nil, interfaces.ErrNotFound
+}
+
+func (m *mockURLRepository) UpdateURL(ctx context.Context, u *models.URL) (*models.URL, error) {
+	if m.shouldFail {
+		return nil, errors.New("mock error")
+	}
+
+	url, exists := m.urls[mockKey(u.Domain, u.ShortCode)]
+	if !exists {
+		return nil, interfaces.ErrNotFound
+	}
+	url.OriginalURL = u.OriginalURL
+	url.NormalizedURL = u.NormalizedURL
+	url.DestinationHash = u.DestinationHash
+	url.RedirectType = u.RedirectType
+	return url, nil
 }
 
-func (m *mockURLRepository) ShortCodeExists(shortCode string) (bool, error) {
+func (m *mockURLRepository) DeleteURL(ctx context.Context, domain, shortCode string) error {
 	if m.shouldFail {
-		return false, errors.New("mock error")
+		return errors.New("mock error")
+	}
+
+	key := mockKey(domain, shortCode)
+	if _, exists := m.urls[key]; !exists {
+		return interfaces.ErrNotFound
 	}
-	return m.shortCodes[shortCode], nil
+	delete(m.urls, key)
+	delete(m.shortCodes, key)
+	return nil
+}
+
+func (m *mockURLRepository) FindURLByDestination(ctx context.Context, ownerID, domain, destinationHash string) (*models.URL, error) {
+	if m.shouldFail {
+		return nil, errors.New("mock error")
+	}
+
+	for _, url := range m.urls {
+		if url.OwnerID == ownerID && url.Domain == domain && url.DestinationHash == destinationHash && !url.IsExpired(time.Now()) {
+			return url, nil
+		}
+	}
+	return nil, interfaces.ErrNotFound
+}
+
+func (m *mockURLRepository) ListURLsByOwner(ctx context.Context, ownerID string, limit, offset int) ([]*models.URL, int, error) {
+	if m.shouldFail {
+		return nil, 0, errors.New("mock error")
+	}
+
+	var owned []*models.URL
+	for _, url := range m.urls {
+		if url.OwnerID == ownerID {
+			owned = append(owned, url)
+		}
+	}
+	total := len(owned)
+	if offset >= total {
+		return []*models.URL{}, total, nil
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return owned[offset:end], total, nil
 }
 
 func TestURLService_ShortenURL(t *testing.T) {
 	repo := newMockURLRepository()
-	service := NewURLService(repo, nil) // No Redis for basic test
+	service := NewURLService(repo, nil, nil, testConfig()) // No Redis for basic test
 
 	ctx := context.Background()
 	originalURL := "https://example.com"
 
-	response, err := service.ShortenURL(ctx, originalURL)
+	response, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: originalURL})
 	if err != nil {
 		t.Fatalf("ShortenURL failed: %v", err)
 	}
@@ -80,69 +195,442 @@ func TestURLService_ShortenURL(t *testing.T) {
 	}
 }
 
+func TestURLService_ShortenURL_Alias(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, nil, nil, testConfig())
+
+	ctx := context.Background()
+
+	response, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com", Alias: "q4-launch"})
+	if err != nil {
+		t.Fatalf("ShortenURL failed: %v", err)
+	}
+	if response.ShortCode != "q4-launch" {
+		t.Errorf("Expected short code q4-launch, got %s", response.ShortCode)
+	}
+
+	_, err = service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.org", Alias: "q4-launch"})
+	if !errors.Is(err, interfaces.ErrAliasTaken) {
+		t.Errorf("Expected ErrAliasTaken, got %v", err)
+	}
+
+	for _, alias := range []string{"Health", "shorten", "bad alias", "a/b", strings.Repeat("a", maxAliasLength+1)} {
+		_, err = service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com", Alias: alias})
+		if !errors.Is(err, interfaces.ErrInvalidAlias) {
+			t.Errorf("Expected ErrInvalidAlias for %q, got %v", alias, err)
+		}
+	}
+}
+
+func TestURLService_ShortenURLs(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, nil, nil, testConfig())
+
+	ctx := context.Background()
+
+	if _, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com", Alias: "taken"}); err != nil {
+		t.Fatalf("ShortenURL failed: %v", err)
+	}
+
+	results, err := service.ShortenURLs(ctx, &models.BatchShortenRequest{
+		OwnerID: "team-a",
+		Items: []models.ShortenRequest{
+			{URL: "https://example.com/1"},
+			{URL: "not a url"},
+			{URL: "https://example.com/2", Alias: "spring"},
+			{URL: "https://example.com/3", Alias: "spring"},
+			{URL: "https://example.com/4", Alias: "taken"},
+			{URL: "https://example.com/5", Alias: "health"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ShortenURLs failed: %v", err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("Expected 6 results, got %d", len(results))
+	}
+
+	wantErrs := []error{nil, interfaces.ErrInvalidURL, nil, interfaces.ErrAliasTaken, interfaces.ErrAliasTaken, interfaces.ErrInvalidAlias}
+	for i, want := range wantErrs {
+		if results[i].Index != i {
+			t.Errorf("Result %d has index %d", i, results[i].Index)
+		}
+		if want == nil {
+			if results[i].Err != nil || results[i].ShortenResponse == nil {
+				t.Errorf("Expected item %d to succeed, got %v", i, results[i].Err)
+			}
+			continue
+		}
+		if !errors.Is(results[i].Err, want) {
+			t.Errorf("Expected item %d to fail with %v, got %v", i, want, results[i].Err)
+		}
+	}
+
+	if url := repo.urls["spring"]; url == nil || url.OwnerID != "team-a" {
+		t.Errorf("Expected alias to be created for team-a, got %+v", url)
+	}
+}
+
 func TestURLService_ResolveURL(t *testing.T) {
 	repo := newMockURLRepository()
-	service := NewURLService(repo, nil) // No Redis for basic test
+	service := NewURLService(repo, nil, nil, testConfig()) // No Redis for basic test
 
 	ctx := context.Background()
 	originalURL := "https://example.com"
 
 	// First, create a URL
-	response, err := service.ShortenURL(ctx, originalURL)
+	response, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: originalURL})
 	if err != nil {
 		t.Fatalf("ShortenURL failed: %v", err)
 	}
 
 	// Then resolve it
-	resolvedURL, err := service.ResolveURL(ctx, response.ShortCode)
+	resolvedURL, err := service.ResolveURL(ctx, "sho.rt", response.ShortCode)
 	if err != nil {
 		t.Fatalf("ResolveURL failed: %v", err)
 	}
 
-	if resolvedURL != originalURL {
-		t.Errorf("Expected resolved URL %s, got %s", originalURL, resolvedURL)
+	if resolvedURL.OriginalURL != originalURL {
+		t.Errorf("Expected resolved URL %s, got %s", originalURL, resolvedURL.OriginalURL)
+	}
+	if resolvedURL.RedirectType != http.StatusFound {
+		t.Errorf("Expected default redirect type %d, got %d", http.StatusFound, resolvedURL.RedirectType)
 	}
 }
 
-func TestURLService_ResolveURL_NotFound(t *testing.T) {
+func TestURLService_ShortenURL_Expiry(t *testing.T) {
 	repo := newMockURLRepository()
-	service := NewURLService(repo, nil)
+	service := NewURLService(repo, nil, nil, testConfig())
 
 	ctx := context.Background()
 
-	_, err := service.ResolveURL(ctx, "nonexistent")
-	if err == nil {
-		t.Error("Expected error for non-existent short code")
+	response, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com", TTLSeconds: 60})
+	if err != nil {
+		t.Fatalf("ShortenURL failed: %v", err)
+	}
+	if response.ExpiresAt == nil || time.Until(*response.ExpiresAt) > time.Minute {
+		t.Errorf("Expected expiry within a minute, got %v", response.ExpiresAt)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	_, err = service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com", ExpiresAt: &past})
+	if !errors.Is(err, interfaces.ErrInvalidExpiry) {
+		t.Errorf("Expected ErrInvalidExpiry for past expiry, got %v", err)
+	}
+
+	future := time.Now().Add(time.Hour)
+	_, err = service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com", ExpiresAt: &future, TTLSeconds: 60})
+	if !errors.Is(err, interfaces.ErrInvalidExpiry) {
+		t.Errorf("Expected ErrInvalidExpiry for conflicting expiry, got %v", err)
 	}
 }
 
-func TestURLService_generateShortCode(t *testing.T) {
-	service := NewURLService(nil, nil)
+func TestURLService_Domains(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, nil, nil, testConfig())
+
+	ctx := context.Background()
 
-	shortCode, err := service.generateShortCode()
+	primary, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com/a", Alias: "promo"})
 	if err != nil {
-		t.Fatalf("generateShortCode failed: %v", err)
+		t.Fatalf("ShortenURL failed: %v", err)
+	}
+	if primary.ShortURL != "https://sho.rt/promo" {
+		t.Errorf("Expected short URL https://sho.rt/promo, got %s", primary.ShortURL)
 	}
 
-	if shortCode == "" {
-		t.Error("Expected non-empty short code")
+	// The same alias is free on another domain
+	other, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com/b", Alias: "promo", Domain: "Go.Example.com"})
+	if err != nil {
+		t.Fatalf("ShortenURL on second domain failed: %v", err)
+	}
+	if other.ShortURL != "https://go.example.com/promo" {
+		t.Errorf("Expected short URL https://go.example.com/promo, got %s", other.ShortURL)
 	}
 
-	if len(shortCode) > 8 {
-		t.Errorf("Short code too long: %s", shortCode)
+	_, err = service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com", Domain: "evil.example.net"})
+	if !errors.Is(err, interfaces.ErrInvalidDomain) {
+		t.Errorf("Expected ErrInvalidDomain, got %v", err)
 	}
 
-	// Generate multiple codes to check uniqueness
-	codes := make(map[string]bool)
-	for i := 0; i < 100; i++ {
-		code, err := service.generateShortCode()
+	tests := map[string]string{
+		"sho.rt":              "https://example.com/a",
+		"localhost:8080":      "https://example.com/a",
+		"go.example.com":      "https://example.com/b",
+		"go.example.com:8443": "https://example.com/b",
+	}
+	for host, want := range tests {
+		got, err := service.ResolveURL(ctx, host, "promo")
 		if err != nil {
-			t.Fatalf("generateShortCode failed on iteration %d: %v", i, err)
+			t.Errorf("ResolveURL(%s) failed: %v", host, err)
+			continue
 		}
-
-		if codes[code] {
-			t.Errorf("Duplicate short code generated: %s", code)
+		if got.OriginalURL != want {
+			t.Errorf("ResolveURL(%s) = %s, want %s", host, got.OriginalURL, want)
 		}
-		codes[code] = true
+	}
+}
+
+func TestURLService_ShortenURL_RedirectType(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, nil, nil, testConfig())
+
+	response, err := service.ShortenURL(context.Background(), &models.ShortenRequest{
+		URL:          "https://example.com",
+		RedirectType: http.StatusPermanentRedirect,
+	})
+	if err != nil {
+		t.Fatalf("ShortenURL failed: %v", err)
+	}
+	if response.RedirectType != http.StatusPermanentRedirect {
+		t.Errorf("Expected redirect type %d, got %d", http.StatusPermanentRedirect, response.RedirectType)
+	}
+
+	_, err = service.ShortenURL(context.Background(), &models.ShortenRequest{URL: "https://example.com", RedirectType: 999})
+	if !errors.Is(err, interfaces.ErrInvalidRedirectType) {
+		t.Errorf("Expected ErrInvalidRedirectType for 999, got %v", err)
+	}
+
+	_, err = service.UpdateURL(context.Background(), "", "", response.ShortCode, &models.UpdateURLRequest{RedirectType: http.StatusOK})
+	if !errors.Is(err, interfaces.ErrInvalidRedirectType) {
+		t.Errorf("Expected ErrInvalidRedirectType updating to 200, got %v", err)
+	}
+}
+
+func TestCachedURL_RoundTrip(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	url := &models.URL{OriginalURL: "https://example.com", RedirectType: http.StatusTemporaryRedirect, ExpiresAt: &expiresAt}
+
+	decoded, ok := decodeCachedURL("", "abc", encodeCachedURL(url))
+	if !ok {
+		t.Fatal("Expected cached value to decode")
+	}
+	if decoded.OriginalURL != url.OriginalURL || decoded.RedirectType != url.RedirectType || !decoded.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Unexpected decoded URL: %+v", decoded)
+	}
+
+	// Entries written before redirect types were cached are plain URLs
+	if _, ok := decodeCachedURL("", "abc", "https://example.com"); ok {
+		t.Error("Expected legacy cache value to be treated as a miss")
+	}
+}
+
+func TestURLService_ResolveURL_Expired(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, nil, nil, testConfig())
+
+	expired := time.Now().Add(-time.Minute)
+	repo.urls["old"] = &models.URL{OriginalURL: "https://example.com", ShortCode: "old", ExpiresAt: &expired}
+
+	_, err := service.ResolveURL(context.Background(), "sho.rt", "old")
+	if !errors.Is(err, interfaces.ErrLinkExpired) {
+		t.Errorf("Expected ErrLinkExpired, got %v", err)
+	}
+}
+
+func TestURLService_ManageURLs(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, nil, nil, testConfig())
+
+	ctx := context.Background()
+
+	response, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com", OwnerID: "team-a"})
+	if err != nil {
+		t.Fatalf("ShortenURL failed: %v", err)
+	}
+	code := response.ShortCode
+
+	if _, err := service.GetURL(ctx, "team-b", "", code); !errors.Is(err, interfaces.ErrLinkNotFound) {
+		t.Errorf("Expected ErrLinkNotFound for another owner, got %v", err)
+	}
+
+	updated, err := service.UpdateURL(ctx, "team-a", "", code, &models.UpdateURLRequest{URL: "https://example.org"})
+	if err != nil {
+		t.Fatalf("UpdateURL failed: %v", err)
+	}
+	if updated.OriginalURL != "https://example.org" {
+		t.Errorf("Expected updated destination, got %s", updated.OriginalURL)
+	}
+
+	updated, err = service.UpdateURL(ctx, "team-a", "", code, &models.UpdateURLRequest{RedirectType: http.StatusMovedPermanently})
+	if err != nil {
+		t.Fatalf("UpdateURL failed: %v", err)
+	}
+	if updated.OriginalURL != "https://example.org" || updated.RedirectType != http.StatusMovedPermanently {
+		t.Errorf("Expected only the redirect type to change, got %+v", updated)
+	}
+
+	list, err := service.ListURLs(ctx, "team-a", 1, 0)
+	if err != nil {
+		t.Fatalf("ListURLs failed: %v", err)
+	}
+	if list.Total != 1 || len(list.URLs) != 1 || list.PageSize != defaultPageSize {
+		t.Errorf("Unexpected list: %+v", list)
+	}
+
+	if err := service.DeleteURL(ctx, "team-b", "", code); !errors.Is(err, interfaces.ErrLinkNotFound) {
+		t.Errorf("Expected ErrLinkNotFound deleting another owner's link, got %v", err)
+	}
+	if err := service.DeleteURL(ctx, "team-a", "", code); err != nil {
+		t.Fatalf("DeleteURL failed: %v", err)
+	}
+	if _, err := service.GetURL(ctx, "team-a", "", code); !errors.Is(err, interfaces.ErrLinkNotFound) {
+		t.Errorf("Expected ErrLinkNotFound after delete, got %v", err)
+	}
+}
+
+func TestURLService_ResolveURL_NotFound(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, nil, nil, testConfig())
+
+	ctx := context.Background()
+
+	_, err := service.ResolveURL(ctx, "sho.rt", "nonexistent")
+	if !errors.Is(err, interfaces.ErrLinkNotFound) {
+		t.Errorf("Expected ErrLinkNotFound for non-existent short code, got %v", err)
+	}
+}
+
+func TestURLService_ContextPropagation(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, nil, nil, testConfig())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A cancelled request must reach the repository rather than be dropped
+	_, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from the repository, got %v", err)
+	}
+}
+
+func TestURLService_ShortenURL_Dedupe(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, nil, nil, testConfig())
+	ctx := context.Background()
+
+	first, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com/page", OwnerID: "team-a"})
+	if err != nil {
+		t.Fatalf("ShortenURL failed: %v", err)
+	}
+
+	// Same destination with a differently cased host returns the same link
+	again, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: "HTTPS://Example.COM/page", OwnerID: "team-a", Dedupe: true})
+	if err != nil {
+		t.Fatalf("ShortenURL failed: %v", err)
+	}
+	if again.ShortCode != first.ShortCode || !again.Deduplicated {
+		t.Errorf("Expected deduplicated %s, got %s (deduplicated=%v)", first.ShortCode, again.ShortCode, again.Deduplicated)
+	}
+
+	tests := []struct {
+		name string
+		req  models.ShortenRequest
+	}{
+		{"dedupe not requested", models.ShortenRequest{URL: "https://example.com/page", OwnerID: "team-a"}},
+		{"other owner", models.ShortenRequest{URL: "https://example.com/page", OwnerID: "team-b", Dedupe: true}},
+		{"other domain", models.ShortenRequest{URL: "https://example.com/page", OwnerID: "team-a", Domain: "go.example.com", Dedupe: true}},
+		{"alias", models.ShortenRequest{URL: "https://example.com/page", OwnerID: "team-a", Alias: "page", Dedupe: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := service.ShortenURL(ctx, &tt.req)
+			if err != nil {
+				t.Fatalf("ShortenURL failed: %v", err)
+			}
+			if resp.Deduplicated || (resp.Domain == first.Domain && resp.ShortCode == first.ShortCode) {
+				t.Errorf("Expected a new link, got %s", resp.ShortCode)
+			}
+		})
+	}
+}
+
+func TestURLService_ShortenURLs_Dedupe(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, nil, nil, testConfig())
+
+	results, err := service.ShortenURLs(context.Background(), &models.BatchShortenRequest{
+		OwnerID: "team-a",
+		Items: []models.ShortenRequest{
+			{URL: "https://example.com/a", Dedupe: true},
+			{URL: "https://EXAMPLE.com/a", Dedupe: true},
+			{URL: "https://example.com/a"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ShortenURLs failed: %v", err)
+	}
+
+	if results[0].ShortCode != results[1].ShortCode || !results[1].Deduplicated {
+		t.Errorf("Expected item 1 to reuse item 0's code, got %s and %s", results[0].ShortCode, results[1].ShortCode)
+	}
+	if results[2].ShortCode == results[0].ShortCode {
+		t.Error("Expected item without dedupe to get its own code")
+	}
+	if len(repo.urls) != 2 {
+		t.Errorf("Expected 2 links to be created, got %d", len(repo.urls))
+	}
+}
+
+func TestURLService_ShortenURL_Canonical(t *testing.T) {
+	repo := newMockURLRepository()
+	cfg := testConfig()
+	cfg.TrackingParams = []string{"utm_*"}
+	service := NewURLService(repo, nil, nil, cfg)
+	ctx := context.Background()
+
+	raw := "https://Example.com:443/a/../b?utm_source=x"
+	first, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: raw, OwnerID: "team-a"})
+	if err != nil {
+		t.Fatalf("ShortenURL failed: %v", err)
+	}
+
+	// The raw URL is what the link redirects to; the canonical form is stored alongside
+	stored := repo.urls[first.ShortCode]
+	if stored.OriginalURL != raw || stored.NormalizedURL != "https://example.com/b" {
+		t.Errorf("Expected raw %s and normalized https://example.com/b, got %s and %s", raw, stored.OriginalURL, stored.NormalizedURL)
+	}
+
+	again, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com/b", OwnerID: "team-a", Dedupe: true})
+	if err != nil {
+		t.Fatalf("ShortenURL failed: %v", err)
+	}
+	if again.ShortCode != first.ShortCode {
+		t.Errorf("Expected equivalent URL to dedupe to %s, got %s", first.ShortCode, again.ShortCode)
+	}
+}
+
+func TestURLService_ShortenURL_RetriesConflicts(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, nil, nil, testConfig())
+	ctx := context.Background()
+
+	// Codes taken concurrently by other requests are replaced and retried
+	repo.conflicts = maxCodeAttempts - 1
+	resp, err := service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("Expected retry to succeed, got %v", err)
+	}
+	if !repo.shortCodes[resp.ShortCode] {
+		t.Errorf("Expected %s to be stored", resp.ShortCode)
+	}
+
+	// Running out of attempts reports an exhausted keyspace
+	repo.conflicts = maxCodeAttempts
+	_, err = service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com"})
+	var exhausted *interfaces.KeyspaceExhaustedError
+	if !errors.As(err, &exhausted) || !errors.Is(err, interfaces.ErrKeyspaceExhausted) {
+		t.Fatalf("Expected KeyspaceExhaustedError, got %v", err)
+	}
+	if exhausted.Attempts != maxCodeAttempts {
+		t.Errorf("Expected %d attempts, got %d", maxCodeAttempts, exhausted.Attempts)
+	}
+
+	// An alias that loses the insert race is reported as taken, not retried
+	repo.conflicts = 1
+	_, err = service.ShortenURL(ctx, &models.ShortenRequest{URL: "https://example.com", Alias: "launch"})
+	if !errors.Is(err, interfaces.ErrAliasTaken) {
+		t.Errorf("Expected ErrAliasTaken, got %v", err)
 	}
 }
@@ -0,0 +1,152 @@
+package shortcode
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+)
+
+// feistelRounds is enough rounds for the permutation to look random; it is
+// an obfuscation, not encryption.
+const feistelRounds = 4
+
+// Counter hands out increasing values, each at most once, shared by every
+// instance of the service.
+type Counter interface {
+	Next(ctx context.Context) (uint64, error)
+}
+
+// Sequential turns counter values into fixed-length codes. Each value is
+// passed through a keyed permutation of the code space, so consecutive
+// values give unrelated codes and codes cannot be enumerated without the
+// secret, while every code stays unique and can be decoded back.
+type Sequential struct {
+	counter  Counter
+	alphabet string
+	length   int
+	space    uint64 // number of distinct codes, len(alphabet)^length
+	half     uint   // bits in each Feistel half
+	key      []byte
+}
+
+func NewSequential(counter Counter, alphabet string, length int, secret string) (*Sequential, error) {
+	if err := validateLength(length); err != nil {
+		return nil, err
+	}
+	if counter == nil {
+		return nil, fmt.Errorf("%w: counter codes need a counter", ErrInvalidConfig)
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("%w: counter codes need a secret", ErrInvalidConfig)
+	}
+
+	space := uint64(1)
+	for i := 0; i < length; i++ {
+		hi, lo := bits.Mul64(space, uint64(len(alphabet)))
+		if hi != 0 || lo >= 1<<62 {
+			return nil, fmt.Errorf("%w: length %d is too long for the alphabet", ErrInvalidConfig, length)
+		}
+		space = lo
+	}
+
+	return &Sequential{
+		counter:  counter,
+		alphabet: alphabet,
+		length:   length,
+		space:    space,
+		half:     uint(bits.Len64(space-1)+1) / 2,
+		key:      []byte(secret),
+	}, nil
+}
+
+func (s *Sequential) Generate(ctx context.Context) (string, error) {
+	n, err := s.counter.Next(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get counter value: %w", err)
+	}
+	if n >= s.space {
+		return "", &interfaces.KeyspaceExhaustedError{Attempts: 1}
+	}
+	return s.encode(s.permute(n)), nil
+}
+
+// Decode returns the counter value a code was generated from.
+func (s *Sequential) Decode(code string) (uint64, error) {
+	if len(code) != s.length {
+		return 0, fmt.Errorf("code must be %d characters", s.length)
+	}
+	var n uint64
+	for i := 0; i < len(code); i++ {
+		digit := strings.IndexByte(s.alphabet, code[i])
+		if digit < 0 {
+			return 0, fmt.Errorf("invalid character %q", code[i])
+		}
+		n = n*uint64(len(s.alphabet)) + uint64(digit)
+	}
+	return s.unpermute(n), nil
+}
+
+func (s *Sequential) encode(n uint64) string {
+	base := uint64(len(s.alphabet))
+	code := make([]byte, s.length)
+	for i := s.length - 1; i >= 0; i-- {
+		code[i] = s.alphabet[n%base]
+		n /= base
+	}
+	return string(code)
+}
+
+// permute maps [0, space) onto itself one-to-one. The Feistel network works
+// on a power-of-two domain at least as large as the code space; results
+// that fall outside the code space are permuted again ("cycle walking")
+// until they land inside it.
+func (s *Sequential) permute(n uint64) uint64 {
+	for {
+		n = s.feistel(n, false)
+		if n < s.space {
+			return n
+		}
+	}
+}
+
+func (s *Sequential) unpermute(n uint64) uint64 {
+	for {
+		n = s.feistel(n, true)
+		if n < s.space {
+			return n
+		}
+	}
+}
+
+func (s *Sequential) feistel(n uint64, inverse bool) uint64 {
+	mask := uint64(1)<<s.half - 1
+	left, right := n>>s.half, n&mask
+
+	for i := 0; i < feistelRounds; i++ {
+		if inverse {
+			round := feistelRounds - 1 - i
+			left, right = right^s.round(round, left)&mask, left
+		} else {
+			left, right = right, left^s.round(i, right)&mask
+		}
+	}
+
+	return left<<s.half | right
+}
+
+// round is the keyed Feistel round function.
+func (s *Sequential) round(i int, half uint64) uint64 {
+	var input [9]byte
+	input[0] = byte(i)
+	binary.BigEndian.PutUint64(input[1:], half)
+
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(input[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
@@ -0,0 +1,84 @@
+// Package shortcode generates short codes for new links.
+package shortcode
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+)
+
+// Generator kinds selectable by configuration.
+const (
+	KindRandom   = "random"
+	KindFriendly = "friendly"
+	KindCounter  = "counter"
+)
+
+const (
+	// Base62Alphabet is digits and ASCII letters.
+	Base62Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	// FriendlyAlphabet leaves out characters that are easily confused when
+	// read aloud or retyped: 0/O and 1/l/I.
+	FriendlyAlphabet = "23456789abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+
+	DefaultLength = 7
+	MinLength     = 4
+	MaxLength     = 10
+)
+
+// ErrInvalidConfig is returned when a generator is configured with an
+// unknown kind, an out-of-range length or a missing secret.
+var ErrInvalidConfig = errors.New("invalid short code generator config")
+
+// New returns the generator of the given kind. counter and secret are only
+// used by KindCounter.
+func New(kind string, length int, secret string, counter Counter) (interfaces.CodeGenerator, error) {
+	switch strings.ToLower(kind) {
+	case "", KindRandom:
+		return NewRandom(Base62Alphabet, length)
+	case KindFriendly:
+		return NewRandom(FriendlyAlphabet, length)
+	case KindCounter:
+		return NewSequential(counter, Base62Alphabet, length, secret)
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidConfig, kind)
+	}
+}
+
+func validateLength(length int) error {
+	if length < MinLength || length > MaxLength {
+		return fmt.Errorf("%w: length must be between %d and %d", ErrInvalidConfig, MinLength, MaxLength)
+	}
+	return nil
+}
+
+// Random draws each character uniformly from an alphabet using crypto/rand.
+type Random struct {
+	alphabet string
+	length   int
+}
+
+func NewRandom(alphabet string, length int) (*Random, error) {
+	if err := validateLength(length); err != nil {
+		return nil, err
+	}
+	return &Random{alphabet: alphabet, length: length}, nil
+}
+
+func (r *Random) Generate(ctx context.Context) (string, error) {
+	max := big.NewInt(int64(len(r.alphabet)))
+	code := make([]byte, r.length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = r.alphabet[n.Int64()]
+	}
+	return string(code), nil
+}
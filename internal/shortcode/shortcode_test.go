@@ -0,0 +1,138 @@
+package shortcode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jonmanahan/url-shortener/internal/interfaces"
+)
+
+// testCounter hands out consecutive values starting at whatever next holds.
+type testCounter struct {
+	next atomic.Uint64
+}
+
+func (c *testCounter) Next(ctx context.Context) (uint64, error) {
+	return c.next.Add(1) - 1, nil
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		kind    string
+		length  int
+		secret  string
+		wantErr bool
+	}{
+		{"random", 7, "", false},
+		{"", 7, "", false},
+		{"friendly", 6, "", false},
+		{"counter", 6, "s3cret", false},
+		{"counter", 6, "", true},
+		{"random", 2, "", true},
+		{"random", 20, "", true},
+		{"uuid", 7, "", true},
+	}
+
+	for _, tt := range tests {
+		_, err := New(tt.kind, tt.length, tt.secret, &testCounter{})
+		if tt.wantErr != (err != nil) {
+			t.Errorf("New(%q, %d) error = %v, wantErr %v", tt.kind, tt.length, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig, got %v", err)
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	for _, alphabet := range []string{Base62Alphabet, FriendlyAlphabet} {
+		g, err := NewRandom(alphabet, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		codes := make(map[string]bool)
+		for i := 0; i < 1000; i++ {
+			code, err := g.Generate(context.Background())
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			if len(code) != 8 {
+				t.Fatalf("Expected 8 characters, got %q", code)
+			}
+			for _, c := range code {
+				if !strings.ContainsRune(alphabet, c) {
+					t.Fatalf("Unexpected character %q in %q", c, code)
+				}
+			}
+			if codes[code] {
+				t.Errorf("Duplicate code generated: %s", code)
+			}
+			codes[code] = true
+		}
+	}
+}
+
+func TestFriendlyAlphabet(t *testing.T) {
+	if strings.ContainsAny(FriendlyAlphabet, "0O1lI") {
+		t.Error("Friendly alphabet must not contain ambiguous characters")
+	}
+}
+
+func TestSequential(t *testing.T) {
+	g, err := NewSequential(&testCounter{}, Base62Alphabet, 4, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes := make(map[string]bool)
+	var previous string
+	for n := uint64(0); n < 5000; n++ {
+		code, err := g.Generate(context.Background())
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		if len(code) != 4 {
+			t.Fatalf("Expected 4 characters, got %q", code)
+		}
+		if codes[code] {
+			t.Fatalf("Duplicate code %s for counter %d", code, n)
+		}
+		codes[code] = true
+
+		decoded, err := g.Decode(code)
+		if err != nil || decoded != n {
+			t.Fatalf("Decode(%s) = %d, %v; want %d", code, decoded, err, n)
+		}
+
+		// Consecutive counter values should not give neighbouring codes
+		if previous != "" && previous[:3] == code[:3] {
+			t.Errorf("Consecutive codes %s and %s look sequential", previous, code)
+		}
+		previous = code
+	}
+}
+
+func TestSequential_Secret(t *testing.T) {
+	a, _ := NewSequential(&testCounter{}, Base62Alphabet, 6, "one")
+	b, _ := NewSequential(&testCounter{}, Base62Alphabet, 6, "two")
+
+	codeA, _ := a.Generate(context.Background())
+	codeB, _ := b.Generate(context.Background())
+	if codeA == codeB {
+		t.Errorf("Expected different secrets to give different codes, both gave %s", codeA)
+	}
+}
+
+func TestSequential_Exhausted(t *testing.T) {
+	counter := &testCounter{}
+	counter.next.Store(62 * 62 * 62 * 62)
+	g, _ := NewSequential(counter, Base62Alphabet, 4, "s3cret")
+
+	if _, err := g.Generate(context.Background()); !errors.Is(err, interfaces.ErrKeyspaceExhausted) {
+		t.Errorf("Expected ErrKeyspaceExhausted, got %v", err)
+	}
+}
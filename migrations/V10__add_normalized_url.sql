@@ -0,0 +1,7 @@
+-- V10__add_normalized_url.sql
+-- Canonical form of the destination, used for dedupe and policy checks.
+-- Links keep redirecting to original_url. Existing rows start out with their
+-- raw URL, matching how their destination_hash was backfilled in V9.
+ALTER TABLE urls ADD COLUMN normalized_url TEXT;
+
+UPDATE urls SET normalized_url = original_url;
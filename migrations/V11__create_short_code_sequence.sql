@@ -0,0 +1,4 @@
+-- V11__create_short_code_sequence.sql
+-- Source of counter values for counter-based short codes. Values are
+-- permuted before use, so the sequence itself is never exposed.
+CREATE SEQUENCE short_code_seq START 0 MINVALUE 0;
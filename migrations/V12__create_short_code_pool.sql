@@ -0,0 +1,7 @@
+-- V12__create_short_code_pool.sql
+-- Pre-generated short codes not used by any link on any domain. Instances
+-- lease codes by deleting them from this table.
+CREATE TABLE short_code_pool (
+    short_code VARCHAR(32) PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,28 @@
+-- V13__create_plans_and_usage.sql
+-- Quotas for API keys; 0 means unlimited. Update a row to change a plan for
+-- every key on it, or add a plan and assign it to a key for a custom quota.
+CREATE TABLE plans (
+    name VARCHAR(64) PRIMARY KEY,
+    requests_per_minute INTEGER NOT NULL DEFAULT 0 CHECK (requests_per_minute >= 0),
+    links_per_day INTEGER NOT NULL DEFAULT 0 CHECK (links_per_day >= 0),
+    links_per_month INTEGER NOT NULL DEFAULT 0 CHECK (links_per_month >= 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO plans (name, requests_per_minute, links_per_day, links_per_month) VALUES
+    ('free', 60, 100, 1000),
+    ('pro', 600, 10000, 200000),
+    ('unlimited', 0, 0, 0);
+
+-- Keys issued before plans existed stay unlimited; new keys start on free
+ALTER TABLE api_keys ADD COLUMN plan VARCHAR(64) NOT NULL DEFAULT 'unlimited' REFERENCES plans(name);
+ALTER TABLE api_keys ALTER COLUMN plan SET DEFAULT 'free';
+
+-- Links created per key and UTC day; monthly usage is the sum over the days
+-- of the month
+CREATE TABLE api_key_usage (
+    api_key_id INTEGER NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    links_created INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (api_key_id, day)
+);
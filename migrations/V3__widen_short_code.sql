@@ -0,0 +1,3 @@
+-- V3__widen_short_code.sql
+-- Allow custom vanity aliases longer than the generated 8-character codes
+ALTER TABLE urls ALTER COLUMN short_code TYPE VARCHAR(32);
@@ -0,0 +1,7 @@
+-- V4__add_expires_at.sql
+-- Optional expiry for links; NULL means the link never expires
+ALTER TABLE urls ADD COLUMN expires_at TIMESTAMP WITH TIME ZONE;
+
+-- Add partial index for finding expired links during cleanup
+CREATE INDEX idx_urls_expires_at ON urls(expires_at)
+    WHERE expires_at IS NOT NULL;
@@ -0,0 +1,13 @@
+-- V5__create_clicks.sql
+CREATE TABLE clicks (
+    id BIGSERIAL PRIMARY KEY,
+    short_code VARCHAR(32) NOT NULL,
+    clicked_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    referrer TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    -- Client IP with the host portion zeroed (/24 for IPv4, /48 for IPv6)
+    ip_address VARCHAR(45) NOT NULL DEFAULT ''
+);
+
+-- Add index for per-link stats queries
+CREATE INDEX idx_clicks_short_code_clicked_at ON clicks(short_code, clicked_at);
@@ -0,0 +1,17 @@
+-- V6__create_api_keys.sql
+CREATE TABLE api_keys (
+    id SERIAL PRIMARY KEY,
+    owner_id VARCHAR(64) NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    -- SHA-256 hex digest of the key; the plaintext key is never stored
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Links created through the API belong to the owner of the key used
+ALTER TABLE urls ADD COLUMN owner_id VARCHAR(64);
+
+-- Add index for listing an owner's links
+CREATE INDEX idx_urls_owner_id ON urls(owner_id, created_at)
+    WHERE owner_id IS NOT NULL;
@@ -0,0 +1,12 @@
+-- V7__add_domains.sql
+-- Links belong to a short domain; '' is the primary domain (BASE_URL).
+-- The same short code may exist once per domain.
+ALTER TABLE urls ADD COLUMN domain VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE urls DROP CONSTRAINT urls_short_code_key;
+ALTER TABLE urls ADD CONSTRAINT urls_domain_short_code_key UNIQUE (domain, short_code);
+
+ALTER TABLE clicks ADD COLUMN domain VARCHAR(255) NOT NULL DEFAULT '';
+
+DROP INDEX idx_clicks_short_code_clicked_at;
+CREATE INDEX idx_clicks_domain_short_code_clicked_at ON clicks(domain, short_code, clicked_at);
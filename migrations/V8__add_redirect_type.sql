@@ -0,0 +1,7 @@
+-- V8__add_redirect_type.sql
+-- HTTP status used when resolving the link. Existing links keep the 301
+-- they have always been served with; new links get the configured default.
+ALTER TABLE urls ADD COLUMN redirect_type SMALLINT NOT NULL DEFAULT 301;
+
+ALTER TABLE urls ADD CONSTRAINT urls_redirect_type_valid
+    CHECK (redirect_type IN (301, 302, 307, 308));
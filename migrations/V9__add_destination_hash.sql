@@ -0,0 +1,11 @@
+-- V9__add_destination_hash.sql
+-- SHA-256 hex digest of the normalized destination, used to find an owner's
+-- existing link to the same URL. Existing rows are backfilled from the raw
+-- URL, so they only match destinations that were already in normal form.
+ALTER TABLE urls ADD COLUMN destination_hash CHAR(64);
+
+UPDATE urls SET destination_hash = encode(sha256(convert_to(original_url, 'UTF8')), 'hex');
+
+-- Add index for deduplicating an owner's links by destination
+CREATE INDEX idx_urls_owner_destination ON urls(owner_id, destination_hash)
+    WHERE owner_id IS NOT NULL;